@@ -0,0 +1,101 @@
+package dhcp6c
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// Responder is a DHCPv6 server seen by Audit.
+type Responder struct {
+	// Addr is the source address of the messages.
+	Addr net.IP
+	// HWAddr is the MAC address of Addr in the neighbor table, nil if unknown.
+	HWAddr net.HardwareAddr
+	// ServerID is the server DUID, nil if the messages had none.
+	ServerID dhcpv6.DUID
+	// Preference is the value of the Preference option (0 if absent).
+	Preference uint8
+	// Prefixes are the prefixes offered in the last message.
+	Prefixes []*dhcpv6.OptIAPrefix
+	// Invalid is why the last message fails the RFC 8415 checks, nil if it
+	// passes them or validation is disabled: the non compliant servers are
+	// reported too.
+	Invalid error
+	// Count is the number of messages received.
+	Count int
+	// First and Last are the reception times of the first and last message.
+	First, Last time.Time
+}
+
+// Audit sends a solicit message built by newSolicit, collects every
+// advertise or reply during the retransmission timeout and repeats until
+// window elapses. It returns every distinct responder, identified by its
+// source address and server DUID, including those failing the RFC 8415
+// checks (see Responder.Invalid).
+func (c *Client) Audit(ctx context.Context, window time.Duration, newSolicit func() (*dhcpv6.Message, error)) ([]*Responder, error) {
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	var responders []*Responder
+	collect := func(e *Envelope) {
+		msg := e.Message
+		addr := net.IP(e.Source.Addr().AsSlice())
+		serverID := msg.Options.ServerID()
+
+		var r *Responder
+		for _, v := range responders {
+			if v.Addr.Equal(addr) && sameDUID(v.ServerID, serverID) {
+				r = v
+				break
+			}
+		}
+		if r == nil {
+			r = &Responder{Addr: addr, ServerID: serverID, First: e.Received}
+			responders = append(responders, r)
+		}
+		r.Count++
+		r.Last = e.Received
+		r.Invalid = e.Invalid
+		if opt, ok := msg.GetOneOption(dhcpv6.OptionPreference).(*dhcpv6.OptionGeneric); ok && len(opt.OptionData) == 1 {
+			r.Preference = opt.OptionData[0]
+		}
+		r.Prefixes = nil
+		for _, iapd := range msg.Options.IAPD() {
+			r.Prefixes = append(r.Prefixes, iapd.Options.Prefixes()...)
+		}
+	}
+
+	for ctx.Err() == nil {
+		solicit, err := newSolicit()
+		if err != nil {
+			return responders, err
+		}
+		// a rogue server may not be compliant, it must be reported anyway
+		err = c.collect(ctx, c.serverAddr, solicit, MatchMessage(IsMessageType(dhcpv6.MessageTypeAdvertise, dhcpv6.MessageTypeReply)), collect, true)
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return responders, err
+		}
+	}
+
+	// the neighbor table is best effort
+	if neigh, err := neighbors(); err == nil {
+		for _, r := range responders {
+			r.HWAddr = neigh[r.Addr.String()]
+		}
+	} else {
+		c.logger.Printf("can't read the neighbor table: %v", err)
+	}
+	return responders, nil
+}
+
+func sameDUID(a, b dhcpv6.DUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return bytes.Equal(a.ToBytes(), b.ToBytes())
+}
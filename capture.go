@@ -0,0 +1,119 @@
+package dhcp6c
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// Packet is a datagram sent or received by the client, see WithCapture.
+type Packet struct {
+	// Time is the time the packet was sent, or its receive timestamp (see
+	// Envelope.Received).
+	Time time.Time
+	// Sent is true for the sent packets, false for the received ones.
+	Sent bool
+	// Source and Dest are the UDP endpoints. The local one is the address
+	// the connection is bound to, it can be unspecified.
+	Source netip.AddrPort
+	Dest   netip.AddrPort
+	// Interface is the name of the interface, "" if unknown.
+	Interface string
+	// Payload is the UDP payload: a Relay-Forward or Relay-Reply message in
+	// relay mode. It is not used by the client after the call.
+	Payload []byte
+	// Truncated is true if Payload is incomplete: cut by the snap length or
+	// a fragment of the datagram. It is only set by ReadCapture.
+	Truncated bool
+}
+
+// WithCapture calls fn with every datagram sent or received, the received
+// ones before they are decoded or checked: the malformed and dropped ones
+// are included. fn is called by the sending goroutines and the receive
+// loop, it must be safe for concurrent use and must not block.
+func WithCapture(fn func(p *Packet)) ClientOpt {
+	return func(c *Client) {
+		c.capture = fn
+	}
+}
+
+// localAddrPort returns the address the connection is bound to.
+func (c *Client) localAddrPort() netip.AddrPort {
+	if u, ok := c.conn.LocalAddr().(*net.UDPAddr); ok {
+		return unmap(u.AddrPort())
+	}
+	return netip.AddrPortFrom(netip.IPv6Unspecified(), uint16(c.localPort))
+}
+
+// DryRun returns the datagram the client would send for msg to dest, without
+// sending it: the exact bytes, a Relay-Forward message in relay mode, and the
+// endpoints. When the connection is bound to all addresses, the source is the
+// one the system would choose for dest.
+func (c *Client) DryRun(dest *net.UDPAddr, msg *dhcpv6.Message) (*Packet, error) {
+	b, err := c.encapsulate(msg)
+	if err != nil {
+		return nil, err
+	}
+	p := c.sentPacket(b, dest, time.Now())
+	if p.Source.Addr().IsUnspecified() {
+		// connecting a UDP socket sends nothing
+		probe, err := net.DialUDP("udp6", nil, dest)
+		if err != nil {
+			return nil, err
+		}
+		local := unmap(probe.LocalAddr().(*net.UDPAddr).AddrPort())
+		probe.Close()
+		p.Source = netip.AddrPortFrom(local.Addr().WithZone(""), p.Source.Port())
+	}
+	return p, nil
+}
+
+// captureSent passes a sent datagram to the capture function.
+func (c *Client) captureSent(b []byte, dest net.Addr, ts time.Time) {
+	if c.capture == nil {
+		return
+	}
+	c.capture(c.sentPacket(b, dest, ts))
+}
+
+// sentPacket returns the Packet of a datagram sent to dest.
+func (c *Client) sentPacket(b []byte, dest net.Addr, ts time.Time) *Packet {
+	p := &Packet{Time: ts, Sent: true, Source: c.localAddrPort(), Payload: b}
+	if u, ok := dest.(*net.UDPAddr); ok {
+		p.Dest = unmap(u.AddrPort())
+		p.Interface = u.Zone
+	}
+	if p.Interface == "" {
+		p.Interface = p.Source.Addr().Zone()
+	}
+	p.Source = netip.AddrPortFrom(p.Source.Addr().WithZone(""), p.Source.Port())
+	p.Dest = netip.AddrPortFrom(p.Dest.Addr().WithZone(""), p.Dest.Port())
+	return p
+}
+
+// captureReceived passes a datagram received on the interface ifname to the
+// capture function, b is copied.
+func (c *Client) captureReceived(b []byte, peer net.Addr, ifname string, ts time.Time) {
+	if c.capture == nil {
+		return
+	}
+	local := c.localAddrPort()
+	p := &Packet{
+		Time:      ts,
+		Dest:      netip.AddrPortFrom(local.Addr().WithZone(""), local.Port()),
+		Interface: ifname,
+		Payload:   append([]byte(nil), b...),
+	}
+	if u, ok := peer.(*net.UDPAddr); ok {
+		src := unmap(u.AddrPort())
+		p.Source = netip.AddrPortFrom(src.Addr().WithZone(""), src.Port())
+	}
+	c.capture(p)
+}
+
+// unmap returns ap with an IPv4-mapped address converted to IPv4.
+func unmap(ap netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
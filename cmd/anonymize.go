@@ -0,0 +1,420 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	dhcp6c "github.com/nspeed-app/testdhcpv6pd"
+	"nspeed.app/nspeed/utils"
+)
+
+// anonymizer hides the identifying data of the output: the -a format masks
+// them with xxxx, or with a key (-pkey) they are replaced by pseudonyms,
+// stable for a given key so that reports can be correlated.
+type anonymizer struct {
+	format string
+	key    []byte
+}
+
+// anon is the anonymizer of the command line options, set by main
+var anon = &anonymizer{format: utils.FormatV6Full}
+
+// newAnonymizer returns an anonymizer using format, or pseudonyms if key is
+// not empty (@file reads the key from a file).
+func newAnonymizer(format, key string) (*anonymizer, error) {
+	a := &anonymizer{format: format}
+	if strings.HasPrefix(key, "@") {
+		b, err := os.ReadFile(key[1:])
+		if err != nil {
+			return nil, err
+		}
+		key = strings.TrimSpace(string(b))
+		if key == "" {
+			return nil, errors.New("empty pseudonymization key")
+		}
+	}
+	if key != "" {
+		a.key = []byte(key)
+	}
+	return a, nil
+}
+
+var (
+	// reAddr matches the IPv6 address, prefix and MAC address candidates
+	reAddr = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:%[\w.-]+)?(?:/\d{1,3})?`)
+
+	// the identifiers of the dumps, see the String() methods of dhcpv6: the
+	// first group is kept, the second is the value
+	reIdentifiers = []struct {
+		re   *regexp.Regexp
+		kind string
+	}{
+		{regexp.MustCompile(`(IAID=)(0x[0-9a-f]+)`), "hex"},
+		{regexp.MustCompile(`(DUID-LLT\{[^}]*Time=)(\d+)`), "time"},
+		{regexp.MustCompile(`(EnterpriseIdentifier=)([^}]*)`), "text"},
+		{regexp.MustCompile(`(DUID-UUID\{)(0x[0-9a-f]+)`), "hex"},
+		{regexp.MustCompile(`(DUID-Opaque\{Type=\d+ Data=)(0x[0-9a-f]+)`), "hex"},
+		{regexp.MustCompile(`(RemoteID=)(0x[0-9a-f]+)`), "hex"},
+		{regexp.MustCompile(`((?:Client ID|Server ID|Interface ID|Subscriber ID): )(\[[0-9 ]*\])`), "bytes"},
+	}
+)
+
+// anonymizing returns whether something is hidden, the default format
+// shows everything.
+func (a *anonymizer) anonymizing() bool {
+	return a.key != nil || a.format != utils.FormatV6Full
+}
+
+// prf returns n pseudo random bytes derived from the key, domain and data.
+func (a *anonymizer) prf(domain string, data []byte, n int) []byte {
+	var out []byte
+	for ctr := byte(0); len(out) < n; ctr++ {
+		h := hmac.New(sha256.New, a.key)
+		h.Write([]byte(domain))
+		h.Write([]byte{0, ctr})
+		h.Write(data)
+		out = h.Sum(out)
+	}
+	return out[:n]
+}
+
+// pseudoIP returns the pseudonym of the first bits of ip, the other bits are
+// unchanged. It is prefix preserving: addresses sharing their first n bits
+// share the first n bits of their pseudonyms. The scope is kept: link-local
+// addresses keep their prefix, multicast addresses are not changed.
+func (a *anonymizer) pseudoIP(ip net.IP, bits int) net.IP {
+	ip = ip.To16()
+	keep := 3 // still global
+	switch {
+	case ip.IsMulticast() || ip.IsLoopback() || ip.IsUnspecified():
+		return ip
+	case ip.IsLinkLocalUnicast():
+		keep = 64
+	case ip[0]&0xfe == 0xfc:
+		keep = 8 // ULA
+	}
+	out := make(net.IP, net.IPv6len)
+	copy(out, ip)
+	for i := keep; i < bits; i++ {
+		// the flip of bit i depends on the original bits before it
+		prefix := make([]byte, net.IPv6len+1)
+		copy(prefix, ip.Mask(net.CIDRMask(i, 128)))
+		prefix[net.IPv6len] = byte(i)
+		out[i/8] ^= (a.prf("ip", prefix, 1)[0] & 1) << (7 - i%8)
+	}
+	return out
+}
+
+// ip anonymizes a single address
+func (a *anonymizer) ip(ip net.IP) string {
+	if a.key != nil && ip.To4() == nil {
+		return a.pseudoIP(ip, 128).String()
+	}
+	n := &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))}
+	return strings.TrimSuffix(utils.AnonymizeIPNet(n, utils.FormatV4First, a.format), fmt.Sprintf("/%d", 8*len(ip)))
+}
+
+// prefix anonymizes a prefix, the length is kept
+func (a *anonymizer) prefix(n *net.IPNet) string {
+	if a.key != nil && n.IP.To4() == nil {
+		ones, _ := n.Mask.Size()
+		return (&net.IPNet{IP: a.pseudoIP(n.IP, ones), Mask: n.Mask}).String()
+	}
+	return utils.AnonymizeIPNet(n, utils.FormatV4First, a.format)
+}
+
+// mac keeps the vendor part (OUI) of a MAC address
+func (a *anonymizer) mac(hw net.HardwareAddr) string {
+	if !a.anonymizing() || len(hw) < 3 {
+		return hw.String()
+	}
+	if a.key == nil {
+		return hw[:3].String() + strings.Repeat(":xx", len(hw)-3)
+	}
+	hw = append(net.HardwareAddr(nil), hw...)
+	a.macBytes(hw)
+	return hw.String()
+}
+
+// duid anonymizes a DUID in colon separated hex, the DUID type and hardware
+// type (first 4 bytes) are kept
+func (a *anonymizer) duid(duid string) string {
+	if !a.anonymizing() || len(duid) <= 11 {
+		return duid
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(duid, ":", ""))
+	if a.key == nil || err != nil {
+		return duid[:11] + ":xxxx"
+	}
+	a.duidBytes(b)
+	s := make([]string, len(b))
+	for i, v := range b {
+		s[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(s, ":")
+}
+
+// The binary forms below anonymize in place, keeping the length: the hidden
+// parts are zeroed, or replaced by the same pseudonyms as the text forms.
+
+// ipBytes anonymizes the first bits of the IPv6 address b
+func (a *anonymizer) ipBytes(b []byte, bits int) {
+	if a.key != nil {
+		copy(b, a.pseudoIP(net.IP(b), bits))
+		return
+	}
+	if ip := net.IP(b); ip.IsMulticast() || ip.IsUnspecified() {
+		// kept as pseudoIP does: ff02::1:2 tells the exchange
+		return
+	}
+	for i := 0; i < 8; i++ {
+		if !strings.ContainsRune(a.format, rune('1'+i)) {
+			b[2*i], b[2*i+1] = 0, 0
+		}
+	}
+}
+
+// macBytes keeps the vendor part (OUI) of the MAC address hw
+func (a *anonymizer) macBytes(hw []byte) {
+	if len(hw) < 3 {
+		return
+	}
+	if a.key != nil {
+		copy(hw[3:], a.prf("mac", hw, len(hw)-3))
+		return
+	}
+	clear(hw[3:])
+}
+
+// idBytes anonymizes an opaque identifier
+func (a *anonymizer) idBytes(b []byte) {
+	if a.key != nil {
+		copy(b, a.prf("id", b, len(b)))
+		return
+	}
+	clear(b)
+}
+
+// duidBytes keeps the DUID type and hardware type (first 4 bytes) of a DUID
+func (a *anonymizer) duidBytes(b []byte) {
+	switch {
+	case len(b) <= 4:
+	case a.key == nil:
+		clear(b[4:])
+	case b[1] == 1 && b[3] == 1 && len(b) == 14:
+		// DUID-LLT with an Ethernet address: same pseudonyms as the dumps
+		copy(b[4:8], a.prf("time", b[4:8], 4))
+		a.macBytes(b[8:])
+	case b[1] == 3 && b[3] == 1 && len(b) == 10:
+		a.macBytes(b[4:])
+	default:
+		a.idBytes(b[4:])
+	}
+}
+
+// message anonymizes the DHCPv6 message b, relay messages included, and
+// returns false if it can't be parsed.
+func (a *anonymizer) message(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	switch dhcpv6.MessageType(b[0]) {
+	case dhcpv6.MessageTypeRelayForward, dhcpv6.MessageTypeRelayReply:
+		if len(b) < 34 {
+			return false
+		}
+		a.ipBytes(b[2:18], 128)  // link-address
+		a.ipBytes(b[18:34], 128) // peer-address
+		return a.options(b[34:])
+	}
+	return len(b) >= 4 && a.options(b[4:])
+}
+
+// options anonymizes the options b and returns false if they can't be
+// parsed.
+func (a *anonymizer) options(b []byte) bool {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return false
+		}
+		code := dhcpv6.OptionCode(binary.BigEndian.Uint16(b))
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return false
+		}
+		data := b[4 : 4+n]
+		b = b[4+n:]
+
+		ok := true
+		switch code {
+		case dhcpv6.OptionClientID, dhcpv6.OptionServerID:
+			a.duidBytes(data)
+		case dhcpv6.OptionIANA, dhcpv6.OptionIAPD:
+			// IAID, T1, T2
+			if ok = len(data) >= 12 && a.options(data[12:]); ok {
+				a.idBytes(data[:4])
+			}
+		case dhcpv6.OptionIATA:
+			if ok = len(data) >= 4 && a.options(data[4:]); ok {
+				a.idBytes(data[:4])
+			}
+		case dhcpv6.OptionIAAddr:
+			if ok = len(data) >= 24 && a.options(data[24:]); ok {
+				a.ipBytes(data[:16], 128)
+			}
+		case dhcpv6.OptionIAPrefix:
+			// lifetimes, prefix length, prefix
+			if ok = len(data) >= 25 && a.options(data[25:]); ok {
+				a.ipBytes(data[9:25], min(int(data[8]), 128))
+			}
+		case dhcpv6.OptionRelayMsg:
+			ok = a.message(data)
+		case dhcpv6.OptionInterfaceID, dhcpv6.OptionRelayAgentSubscriberID:
+			a.idBytes(data)
+		case dhcpv6.OptionRemoteID:
+			// enterprise number, remote-id
+			if ok = len(data) >= 4; ok {
+				a.idBytes(data[4:])
+			}
+		case dhcpv6.OptionDNSRecursiveNameServer, dhcpv6.OptionSNTPServerList:
+			if ok = len(data)%16 == 0; ok {
+				for i := 0; i < len(data); i += 16 {
+					a.ipBytes(data[i:i+16], 128)
+				}
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// capture anonymizes a captured packet, its addresses and payload, and
+// returns false if the payload can't be parsed.
+func (a *anonymizer) capture(p *dhcp6c.Packet) bool {
+	addrPort := func(ap netip.AddrPort) netip.AddrPort {
+		if !ap.Addr().Is6() {
+			return ap
+		}
+		b := ap.Addr().As16()
+		a.ipBytes(b[:], 128)
+		return netip.AddrPortFrom(netip.AddrFrom16(b), ap.Port())
+	}
+	p.Source, p.Dest = addrPort(p.Source), addrPort(p.Dest)
+	return a.message(p.Payload)
+}
+
+// iaid anonymizes an IAID, with the same pseudonym as in the dumps
+func (a *anonymizer) iaid(iaid [4]byte) string {
+	s := fmt.Sprintf("%#x", iaid[:])
+	if !a.anonymizing() {
+		return s
+	}
+	return a.identifier("hex", s)
+}
+
+// identifier anonymizes the value of a dump identifier, see reIdentifiers
+func (a *anonymizer) identifier(kind, v string) string {
+	if a.key == nil {
+		if kind == "bytes" {
+			return "[xxxx]"
+		}
+		return "xxxx"
+	}
+	switch kind {
+	case "hex":
+		b, err := hex.DecodeString(strings.TrimPrefix(v, "0x"))
+		if err == nil {
+			return fmt.Sprintf("%#x", a.prf("id", b, len(b)))
+		}
+	case "time":
+		t, err := strconv.ParseUint(v, 10, 32)
+		if err == nil {
+			b := binary.BigEndian.AppendUint32(nil, uint32(t))
+			return strconv.FormatUint(uint64(binary.BigEndian.Uint32(a.prf("time", b, 4))), 10)
+		}
+	case "bytes":
+		var b []byte
+		for _, f := range strings.Fields(strings.Trim(v, "[]")) {
+			n, _ := strconv.ParseUint(f, 10, 8)
+			b = append(b, byte(n))
+		}
+		return fmt.Sprint(a.prf("id", b, len(b)))
+	case "text":
+		return fmt.Sprintf("%#x", a.prf("id", []byte(v), len(v)))
+	}
+	return "xxxx"
+}
+
+// text anonymizes a log line, usually a packet dump: IPv6 addresses and
+// prefixes, MAC addresses, DUIDs, IAIDs and the relay identifiers.
+func (a *anonymizer) text(s string) string {
+	if !a.anonymizing() {
+		return s
+	}
+	for _, id := range reIdentifiers {
+		s = id.re.ReplaceAllStringFunc(s, func(m string) string {
+			sub := id.re.FindStringSubmatch(m)
+			return sub[1] + a.identifier(id.kind, sub[2])
+		})
+	}
+	return reAddr.ReplaceAllStringFunc(s, a.token)
+}
+
+// token anonymizes tok if it is an IPv6 address (with a zone or a prefix
+// length) or a MAC address, and returns it unchanged otherwise (a time for
+// instance).
+func (a *anonymizer) token(tok string) string {
+	addr, zone, bits := tok, "", -1
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		v, err := strconv.Atoi(addr[i+1:])
+		if err != nil || v > 128 {
+			return tok
+		}
+		addr, bits = addr[:i], v
+	}
+	if i := strings.IndexByte(addr, '%'); i >= 0 {
+		addr, zone = addr[:i], addr[i:]
+	}
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		if bits < 0 {
+			return a.ip(ip) + zone
+		}
+		return a.prefix(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, 128)})
+	}
+	if hw, err := net.ParseMAC(tok); err == nil {
+		return a.mac(hw)
+	}
+	return tok
+}
+
+// attr anonymizes the values of the structured logs
+func (a *anonymizer) attr(groups []string, attr slog.Attr) slog.Attr {
+	switch v := attr.Value.Any().(type) {
+	case string:
+		if attr.Key == "server_duid" {
+			return slog.String(attr.Key, a.duid(v))
+		}
+		return slog.String(attr.Key, a.text(v))
+	case []string:
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = a.text(v[i])
+		}
+		return slog.Any(attr.Key, s)
+	}
+	return attr
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+	dhcp6c "github.com/nspeed-app/testdhcpv6pd"
+	"nspeed.app/nspeed/utils"
+)
+
+// The audit reports the responses echoing another Client Identifier with
+// the reason (see -audit): the DUID must not appear in the anonymized text.
+func TestAnonymizeInvalidClientID(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55}
+	other := &dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{0x02, 0x66, 0x77, 0x88, 0x99, 0xaa}}
+
+	// a server answering with the Client Identifier of another client
+	server, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			n, peer, err := server.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			solicit, err := dhcpv6.MessageFromBytes(b[:n])
+			if err != nil {
+				continue
+			}
+			advertise := &dhcpv6.Message{MessageType: dhcpv6.MessageTypeAdvertise, TransactionID: solicit.TransactionID}
+			advertise.AddOption(dhcpv6.OptClientID(other))
+			advertise.AddOption(dhcpv6.OptServerID(&dhcpv6.DUIDLL{HWType: iana.HWTypeEthernet, LinkLayerAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}))
+			server.WriteTo(advertise.ToBytes(), peer)
+		}
+	}()
+
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skip(err)
+	}
+	client, err := dhcp6c.NewWithConn(conn, mac,
+		dhcp6c.WithBroadcastAddr(server.LocalAddr().(*net.UDPAddr)), dhcp6c.WithTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	responders, err := client.Audit(context.Background(), 200*time.Millisecond, func() (*dhcpv6.Message, error) {
+		return dhcpv6.NewSolicit(mac)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responders) != 1 || responders[0].Invalid == nil {
+		t.Fatalf("responders %v, want one invalid", responders)
+	}
+
+	// the forms of the DUID and of its MAC address
+	data := other.ToBytes()
+	forms := []string{
+		hex.EncodeToString(data),
+		dhcp6c.FormatDUID(other),
+		fmt.Sprint(data),
+		other.LinkLayerAddr.String(),
+		hex.EncodeToString(other.LinkLayerAddr),
+	}
+	for _, tt := range []struct{ format, key string }{{"1234", ""}, {utils.FormatV6Full, "secret"}} {
+		a, err := newAnonymizer(tt.format, tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := a.text(responders[0].Invalid.Error())
+		for _, form := range forms {
+			if strings.Contains(s, form) {
+				t.Errorf("%q (format %s, key %q) contains the DUID as %s", s, tt.format, tt.key, form)
+			}
+		}
+	}
+}
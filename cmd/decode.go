@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	dhcp6c "github.com/nspeed-app/testdhcpv6pd"
+	"nspeed.app/nspeed/utils"
+)
+
+// decode is the decode subcommand: it prints the DHCPv6 messages of captures
+// or hex/base64 dumps, and returns the exit status.
+func decode(args []string) int {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	optAnonymize := fs.String("a", utils.FormatV6Full, "anonymize ip addresses (format = list word indexes to show)")
+	optPseudoKey := fs.String("pkey", "", "pseudonymize instead of masking with -a, with this secret key (or @file)")
+	optFormat := fs.String("format", "auto", "input format: auto, pcap (pcap or pcapng), hex or base64 (one message per line)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s decode [options] [file ...]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Prints the DHCPv6 messages of pcap/pcapng captures, or of hex or base64 messages,\n")
+		fmt.Fprintf(fs.Output(), "read from the files or stdin (no file or -).\n\nAvailable options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	switch *optFormat {
+	case "auto", "pcap", "hex", "base64":
+	default:
+		fmt.Fprintf(os.Stderr, "bad input format %q\n", *optFormat)
+		return 2
+	}
+	a, err := newAnonymizer(*optAnonymize, *optPseudoKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	anon = a
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	d := &decoder{w: bufio.NewWriter(os.Stdout)}
+	defer d.w.Flush()
+	for _, name := range files {
+		if err := d.file(name, *optFormat); err != nil {
+			d.w.Flush()
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			d.failed = true
+		}
+	}
+	if d.failed {
+		return 1
+	}
+	return 0
+}
+
+// decoder prints the decoded messages.
+type decoder struct {
+	w *bufio.Writer
+	// failed is true if a message is malformed
+	failed bool
+}
+
+// file decodes the messages of a file, "-" is stdin.
+func (d *decoder) file(name, format string) error {
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if format == "pcap" || format == "auto" && dhcp6c.IsCapture(b) {
+		return dhcp6c.ReadCapture(bytes.NewReader(b), func(n int, p *dhcp6c.Packet) {
+			src, dst := anon.ip(p.Source.Addr().AsSlice()), anon.ip(p.Dest.Addr().AsSlice())
+			header := fmt.Sprintf("#%d %s [%s]:%d -> [%s]:%d", n, p.Time.Format(time.RFC3339Nano), src, p.Source.Port(), dst, p.Dest.Port())
+			if p.Interface != "" {
+				header += " on " + p.Interface
+			}
+			if p.Truncated {
+				header += " (truncated by the capture)"
+			}
+			d.message(header, p.Payload)
+		})
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		text, _, _ := strings.Cut(s.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		msg, err := parseDump(text, format)
+		if err != nil {
+			fmt.Fprintf(d.w, "line %d: %v\n\n", line, err)
+			d.failed = true
+			continue
+		}
+		d.message(fmt.Sprintf("line %d", line), msg)
+	}
+	return s.Err()
+}
+
+// parseDump decodes a message in hex (spaces, colons and a 0x prefix are
+// allowed) or base64, format auto guesses: base64 if there are other
+// characters than the hex digits.
+func parseDump(text, format string) ([]byte, error) {
+	h := strings.TrimPrefix(strings.ToLower(text), "0x")
+	h = strings.NewReplacer(" ", "", ":", "", "\t", "").Replace(h)
+	isHex := strings.Trim(h, "0123456789abcdef") == ""
+	if format == "hex" || format == "auto" && isHex {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("bad hex: %v", err)
+		}
+		return b, nil
+	}
+	b, err := base64.StdEncoding.Strict().DecodeString(text)
+	if err != nil {
+		b, err = base64.RawStdEncoding.Strict().DecodeString(text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad base64: %v", err)
+	}
+	return b, nil
+}
+
+// message prints a message with the lease summary, or why it is malformed.
+func (d *decoder) message(header string, b []byte) {
+	fmt.Fprintln(d.w, header)
+	defer fmt.Fprintln(d.w)
+
+	m, err := dhcpv6.FromBytes(b)
+	if err != nil {
+		d.failed = true
+		fmt.Fprintf(d.w, "malformed DHCPv6 message (%d bytes): %v\n", len(b), err)
+		for _, line := range diagnose(b) {
+			fmt.Fprintf(d.w, "  %s\n", line)
+		}
+		if anon.anonymizing() {
+			// the bytes can't be anonymized if they can't be parsed
+			fmt.Fprintln(d.w, "  (hex dump not shown when anonymizing)")
+		} else {
+			fmt.Fprint(d.w, indent(hex.Dump(b), "  "))
+		}
+		return
+	}
+	fmt.Fprintln(d.w, anon.text(m.Summary()))
+
+	msg, err := m.GetInnerMessage()
+	if err != nil {
+		fmt.Fprintf(d.w, "no message in the relay message: %v\n", err)
+		d.failed = true
+		return
+	}
+	switch msg.MessageType {
+	case dhcpv6.MessageTypeAdvertise, dhcpv6.MessageTypeReply:
+		lease, err := leaseSummary(msg)
+		for _, line := range lease {
+			fmt.Fprintln(d.w, line)
+		}
+		if err != nil {
+			fmt.Fprintln(d.w, err)
+		}
+	}
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "\n"+prefix) + "\n"
+}
+
+// diagnose walks a malformed message and returns where its structure breaks
+// and which options fail to decode, with their offsets.
+func diagnose(b []byte) []string {
+	var out []string
+	diagnoseMessage(b, 0, &out)
+	if out == nil {
+		out = append(out, "the structure is valid, the message content is rejected")
+	}
+	return out
+}
+
+func diagnoseMessage(b []byte, offset int, out *[]string) {
+	if len(b) == 0 {
+		*out = append(*out, fmt.Sprintf("offset %d: empty message", offset))
+		return
+	}
+	t := dhcpv6.MessageType(b[0])
+	header := 4 // type, transaction ID
+	if t == dhcpv6.MessageTypeRelayForward || t == dhcpv6.MessageTypeRelayReply {
+		header = 34 // type, hop count, link-address, peer-address
+	}
+	if len(b) < header {
+		*out = append(*out, fmt.Sprintf("offset %d: %s header truncated, %d bytes instead of %d", offset, t, len(b), header))
+		return
+	}
+	diagnoseOptions(b[header:], offset+header, "", out)
+}
+
+func diagnoseOptions(b []byte, offset int, path string, out *[]string) {
+	report := func(format string, v ...any) {
+		*out = append(*out, fmt.Sprintf("offset %d: %s", offset, path)+fmt.Sprintf(format, v...))
+	}
+	for len(b) > 0 {
+		if len(b) < 4 {
+			report("%d trailing bytes, too short for an option header", len(b))
+			return
+		}
+		code := dhcpv6.OptionCode(binary.BigEndian.Uint16(b))
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		name := fmt.Sprintf("%s (%d)", code, uint16(code))
+		if len(b) < 4+n {
+			report("option %s length %d exceeds the %d remaining bytes", name, n, len(b)-4)
+			return
+		}
+		data := b[4 : 4+n]
+
+		// the fixed part of the options containing options
+		fixed := -1
+		switch code {
+		case dhcpv6.OptionIANA, dhcpv6.OptionIAPD:
+			fixed = 12 // IAID, T1, T2
+		case dhcpv6.OptionIATA:
+			fixed = 4
+		case dhcpv6.OptionIAAddr:
+			fixed = 24 // address, lifetimes
+		case dhcpv6.OptionIAPrefix:
+			fixed = 25 // lifetimes, prefix length, prefix
+		}
+		switch {
+		case code == dhcpv6.OptionRelayMsg:
+			diagnoseMessage(data, offset+4, out)
+		case fixed >= 0 && n < fixed:
+			report("option %s length %d, at least %d expected", name, n, fixed)
+		case code == dhcpv6.OptionIAPrefix && data[8] > 128:
+			report("option %s prefix length %d", name, data[8])
+		case fixed >= 0:
+			diagnoseOptions(data[fixed:], offset+4+fixed, path+"in "+name+": ", out)
+		default:
+			if _, err := dhcpv6.ParseOption(code, data); err != nil {
+				report("option %s: %v", name, err)
+			}
+		}
+		b = b[4+n:]
+		offset += 4 + n
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	dhcp6c "github.com/nspeed-app/testdhcpv6pd"
+)
+
+// packetInfo describes the datagram of a dry run, printed by -testout json.
+type packetInfo struct {
+	Interface   string       `json:"interface,omitempty"`
+	Source      string       `json:"source"`
+	Destination string       `json:"destination"`
+	Length      int          `json:"length"`
+	Hex         string       `json:"hex"`
+	Message     *messageInfo `json:"message"`
+}
+
+// messageInfo describes a message, the relay fields are only set for the
+// relay messages.
+type messageInfo struct {
+	MessageType   string       `json:"message_type"`
+	TransactionID string       `json:"transaction_id,omitempty"`
+	HopCount      *uint8       `json:"hop_count,omitempty"`
+	LinkAddress   string       `json:"link_address,omitempty"`
+	PeerAddress   string       `json:"peer_address,omitempty"`
+	Options       []optionInfo `json:"options"`
+}
+
+// export writes the datagram c would send for msg in format: hex (the UDP
+// payload, as read by decode), json, or pcap (a pcapng file with the
+// Ethernet frame built with frame). It is anonymized like the captures.
+func export(w io.Writer, format string, c *dhcp6c.Client, msg *dhcpv6.Message, frame dhcp6c.RawConfig) error {
+	p, err := c.DryRun(c.RemoteAddr(), msg)
+	if err != nil {
+		return err
+	}
+	if p.Interface == "" {
+		p.Interface = c.RemoteAddr().Zone
+	}
+	// resolved before the addresses are anonymized
+	srcMAC := append(net.HardwareAddr(nil), c.InterfaceAddr()...)
+	dstMAC, macErr := dhcp6c.DestinationMAC(net.IP(p.Dest.Addr().AsSlice()))
+	if anon.anonymizing() {
+		if !anon.capture(p) {
+			return errors.New("can't anonymize the message")
+		}
+		anon.macBytes(srcMAC)
+		if dstMAC != nil && dstMAC[0]&1 == 0 {
+			anon.macBytes(dstMAC)
+		}
+	}
+
+	switch format {
+	case "hex":
+		_, err = fmt.Fprintln(w, hex.EncodeToString(p.Payload))
+		return err
+	case "json":
+		info := &packetInfo{
+			Interface:   p.Interface,
+			Source:      p.Source.String(),
+			Destination: p.Dest.String(),
+			Length:      len(p.Payload),
+			Hex:         hex.EncodeToString(p.Payload),
+		}
+		m, err := dhcpv6.FromBytes(p.Payload)
+		if err != nil {
+			return err
+		}
+		info.Message = newMessageInfo(m)
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+
+	pw, err := dhcp6c.NewPcapngWriter(w, strings.TrimSpace("testdhcpv6pd "+version))
+	if err != nil {
+		return err
+	}
+	if len(srcMAC) != 6 || macErr != nil {
+		// no Ethernet frame, the IPv6 packet alone
+		if macErr != nil {
+			c.Printf("%v, writing the IPv6 packet without the Ethernet header", macErr)
+		}
+		return pw.WritePacket(p)
+	}
+	return pw.WriteFrame(p, frame.Frame(srcMAC, dstMAC, p))
+}
+
+// newMessageInfo describes m, the values come from the wire bytes which are
+// already anonymized.
+func newMessageInfo(m dhcpv6.DHCPv6) *messageInfo {
+	info := &messageInfo{MessageType: m.Type().String(), Options: []optionInfo{}}
+	var options dhcpv6.Options
+	var relayed dhcpv6.DHCPv6
+	switch m := m.(type) {
+	case *dhcpv6.Message:
+		info.TransactionID = m.TransactionID.String()
+		options = m.Options.Options
+	case *dhcpv6.RelayMessage:
+		hopCount := m.HopCount
+		info.HopCount = &hopCount
+		info.LinkAddress = m.LinkAddr.String()
+		info.PeerAddress = m.PeerAddr.String()
+		options = m.Options.Options
+		relayed = m.Options.RelayMessage()
+	}
+	for _, opt := range options {
+		o := optionInfo{
+			Code:  uint16(opt.Code()),
+			Name:  opt.Code().String(),
+			Value: opt.String(),
+			Data:  hex.EncodeToString(opt.ToBytes()),
+		}
+		if opt.Code() == dhcpv6.OptionRelayMsg && relayed != nil {
+			o.Message = newMessageInfo(relayed)
+		}
+		info.Options = append(info.Options, o)
+	}
+	return info
+}
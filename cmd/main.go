@@ -1,16 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -37,7 +41,7 @@ func init() {
 type myLogger struct {
 	*log.Logger
 	Debug     bool
-	Anonymize string
+	Anonymize *anonymizer
 }
 
 func NewMyLogger() myLogger {
@@ -46,7 +50,7 @@ func NewMyLogger() myLogger {
 
 func (e *myLogger) Printf(format string, v ...interface{}) {
 	if e.Debug {
-		e.Logger.Printf(format, v...)
+		e.Logger.Print(e.Anonymize.text(fmt.Sprintf(format, v...)))
 	}
 }
 func (e *myLogger) PrintMessage(prefix string, message *dhcpv6.Message) {
@@ -78,6 +82,98 @@ func parseInterface(name string) (*net.Interface, error) {
 	return nil, fmt.Errorf("interface not found")
 }
 
+// parseBytes returns the bytes of a text value, or decodes it if it starts with 0x
+func parseBytes(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") {
+		return dhcp6c.ParseHex(s)
+	}
+	return []byte(s), nil
+}
+
+// siteHopLimit is the default hop limit of -dest site.
+const siteHopLimit = 64
+
+// destination returns the server address for dest: "link" for
+// All_DHCP_Relay_Agents_and_Servers, "site" for All_DHCP_Servers or a unicast address.
+func destination(dest string, iface *net.Interface) (*net.UDPAddr, error) {
+	var addr net.UDPAddr
+	switch dest {
+	case "link":
+		addr = *dhcp6c.AllDHCPRelayAgentsAndServers
+	case "site":
+		addr = *dhcp6c.AllDHCPServers
+	default:
+		ip, err := netip.ParseAddr(dest)
+		if err != nil || !ip.Is6() || ip.IsMulticast() {
+			return nil, fmt.Errorf("bad destination %q, must be link, site or an IPv6 unicast address", dest)
+		}
+		addr = net.UDPAddr{IP: ip.WithZone("").AsSlice(), Port: dhcpv6.DefaultServerPort}
+	}
+	// MacOs/darwin needs Zone set to same interface or 'no route to host' error
+	// since this doesn't bother other OSes  , we generalize this
+	// (global unicast addresses don't need a zone)
+	if !addr.IP.IsGlobalUnicast() {
+		addr.Zone = iface.Name
+	}
+	return &addr, nil
+}
+
+// relayConfig builds the relay agent emulation settings from the command line
+func relayConfig(iface *net.Interface) (dhcp6c.RelayConfig, *net.UDPAddr, error) {
+	var relay dhcp6c.RelayConfig
+
+	server, err := netip.ParseAddr(*optRelay)
+	if err != nil || !server.Is6() {
+		return relay, nil, fmt.Errorf("bad relay server address %q", *optRelay)
+	}
+	serverAddr := &net.UDPAddr{IP: server.AsSlice(), Port: dhcpv6.DefaultServerPort, Zone: server.Zone()}
+
+	if *optRelayLink != "" {
+		if relay.LinkAddr = net.ParseIP(*optRelayLink); relay.LinkAddr == nil {
+			return relay, nil, fmt.Errorf("bad relay link-address %q", *optRelayLink)
+		}
+	} else if addrs, err := iface.Addrs(); err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.To4() == nil && n.IP.IsGlobalUnicast() {
+				relay.LinkAddr = n.IP
+				break
+			}
+		}
+	}
+
+	if *optRelayPeer != "" {
+		if relay.PeerAddr = net.ParseIP(*optRelayPeer); relay.PeerAddr == nil {
+			return relay, nil, fmt.Errorf("bad relay peer-address %q", *optRelayPeer)
+		}
+	} else if relay.PeerAddr, err = dhcpv6.GetLinkLocalAddr(iface.Name); err != nil {
+		return relay, nil, err
+	}
+
+	if *optRelayIfID != "" {
+		if relay.InterfaceID, err = parseBytes(*optRelayIfID); err != nil {
+			return relay, nil, fmt.Errorf("bad relay interface-id: %w", err)
+		}
+	}
+	if *optRelayRID != "" {
+		en, value, ok := strings.Cut(*optRelayRID, ":")
+		n, err := strconv.ParseUint(en, 10, 32)
+		if !ok || err != nil {
+			return relay, nil, fmt.Errorf("bad relay remote-id %q", *optRelayRID)
+		}
+		rid, err := parseBytes(value)
+		if err != nil {
+			return relay, nil, fmt.Errorf("bad relay remote-id: %w", err)
+		}
+		relay.RemoteID = &dhcpv6.OptRemoteID{EnterpriseNumber: uint32(n), RemoteID: rid}
+	}
+	if *optRelaySID != "" {
+		if relay.SubscriberID, err = parseBytes(*optRelaySID); err != nil {
+			return relay, nil, fmt.Errorf("bad relay subscriber-id: %w", err)
+		}
+	}
+	return relay, serverAddr, nil
+}
+
 // prefixesFlag implement flag.Value interface
 type prefixesFlag []string
 
@@ -94,19 +190,60 @@ func (i *prefixesFlag) Set(value string) error {
 
 var optPrefixes prefixesFlag
 
+// defaultDUIDFile is empty if the home directory is unknown
+var defaultDUIDFile, _ = dhcp6c.DefaultDUIDFile()
+
 var (
 	optNoDebug   = flag.Bool("s", false, "dont print debug messages")
 	optVersion   = flag.Bool("v", false, "display version")
 	optAnonymize = flag.String("a", utils.FormatV6Full, "anonymize ip addresses (format = list word indexes to show)")
+	optPseudoKey = flag.String("pkey", "", "pseudonymize instead of masking with -a: addresses, prefixes, MACs and DUIDs are replaced by stable fake values derived from this secret key (or @file)")
 	optDUID1     = flag.String("dllt", "", "specify type 1 DUID-LLT using the provided mac address ( : or - separated digits)")
 	optDUID1T    = flag.Uint("dlltt", 0, "specify the Time field for DUID-LLT")
 	optDUID3     = flag.String("dll", "", "specify type 3 DUID-LL using the provided mac address ( : or - separated digits)")
 	optDUID4     = flag.String("duu", "", "specify type 4 DUID-UUID (format: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx)")
+	optDUIDRaw   = flag.String("duid", "", "specify the full DUID in hex, type code included (any DUID type or hardware type)")
+	optCID       = flag.String("cid", "", "override the Client Identifier option with raw hex bytes, sent as is (can be malformed)")
+	optDUIDFile  = flag.String("duidfile", defaultDUIDFile, "DUID state file, used when no DUID is specified: created on first run then reused (empty = new DUID each run)")
+	optNewDUID   = flag.Bool("newduid", false, "generate a new DUID and replace the one stored in the DUID state file")
+	optImport    = flag.String("import", "", "use the DUID and IAIDs of another client (format[:path], format = dhcpcd, odhcp6c, networkd, dhclient or wide)")
+	optDest      = flag.String("dest", "link", "destination: link (ff02::1:2), site (ff05::1:3) or the unicast address of a server")
+	optRelay     = flag.String("relay", "", "relay agent emulation: send Relay-Forward messages to this server address (port 547)")
+	optRelayLink = flag.String("relaylink", "", "relay link-address (default is the first global address of the interface)")
+	optRelayPeer = flag.String("relaypeer", "", "relay peer-address (default is the link-local address of the interface)")
+	optRelayIfID = flag.String("relayifid", "", "relay Interface-ID option (text, or hex with 0x prefix)")
+	optRelayRID  = flag.String("relayremoteid", "", "relay Remote-ID option, RFC 4649 (format: enterprise-number:value, value is text or hex with 0x prefix)")
+	optRelaySID  = flag.String("relaysubid", "", "relay Subscriber-ID option, RFC 4580 (text, or hex with 0x prefix)")
+	optRaw       = flag.Bool("raw", false, "send and receive with a raw AF_PACKET socket (Linux only, needs CAP_NET_RAW)")
+	optVLAN      = flag.Uint("vlan", 0, "802.1Q VLAN ID of the sent frames (implies -raw)")
+	optPCP       = flag.Uint("pcp", 0, "802.1p priority (PCP, 0-7) of the sent frames (implies -raw)")
+	optDSCP      = flag.Uint("dscp", 0, "DSCP (0-63) of the sent packets (IPv6 traffic class)")
+	optHopLimit  = flag.Uint("hoplimit", 0, "hop limit of the multicast packets (default is the system default, 1, or 64 with -dest site)")
+	optMcastIf   = flag.String("mcastif", "", "outgoing interface of the multicast packets, name or index (default is the interface given)")
+	optRcvBuf    = flag.Int("rcvbuf", 0, "size of the socket receive buffer in bytes (default is the system default)")
+	optAudit     = flag.Duration("audit", 0, "audit mode: keep soliciting during this time window (ex: 30s) and report every responding server")
+	optAllow     = flag.String("allow", "", "expected server DUIDs for -audit, in hex (comma separated, or @file with one DUID per line), unknown servers make the exit status 3")
+	optRapid     = flag.Bool("rapid", false, "add the Rapid Commit option, accept a Reply or an Advertise (a Reply commits the binding on the server)")
+	optSrc       = flag.String("src", "", "link-local source address, when the interface has several (default is the first one)")
+	optPort      = flag.Int("port", dhcpv6.DefaultClientPort, "local UDP port, the server or relay must reply to it (a port above 1023 needs no privileges)")
+	optCoexist   = flag.String("coexist", "", "share the client port with a running DHCPv6 client: shared (raw socket, Linux only, needs CAP_NET_RAW) or reuse (SO_REUSEPORT, the other client must set it too)")
+	optMetrics   = flag.String("metrics", "", "write the client counters and RTT histograms to this file in the Prometheus text format (for the node_exporter textfile collector)")
+	optPcap      = flag.String("pcap", "", "write the sent and received packets to this pcapng file (anonymized with -a or -pkey)")
+	optOutput    = flag.String("o", "text", "format of the result on stdout: text (log lines), json or yaml (the debug messages still go to stderr)")
+	optLog       = flag.String("log", "text", "format of the debug messages: text, or json for structured events (one JSON object per line)")
+	optNoCheck   = flag.Bool("novalidate", false, "accept responses failing the RFC 8415 checks (Client Identifier echo, Server Identifier present, message type)")
+	optWait      = flag.Duration("wait", 0, "wait up to this time (ex: 10s) for the interface to be up with a usable link-local address")
 	optDryRun    = flag.Bool("test", false, "dry-run only,  print the solicit paquet, nothing is send on the network")
+	optTestOut   = flag.String("testout", "", "dry-run (implies -test) and write the message to send on stdout: hex (UDP payload), json, or pcap (pcapng with the Ethernet frame)")
+	optXID       = flag.String("xid", "", "transaction ID in hex, 3 bytes (default is random, fix it to get the same bytes across -test runs)")
 )
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "decode" {
+		os.Exit(decode(os.Args[2:]))
+	}
+
 	flag.Var(&optPrefixes, "p", "ask for a specific prefix and/or length (repeatable, default is one prefix of ::/64)")
 	flag.Parse()
 
@@ -116,12 +253,46 @@ func main() {
 	}
 	if len(flag.Args()) != 1 {
 		fmt.Printf("Usage: %s [options] [interface name] or [interface index]\n", os.Args[0])
+		fmt.Printf("       %s decode [options] [file ...] (see %s decode -h)\n", os.Args[0], os.Args[0])
 		displayInterfaces()
 		fmt.Println("\nAvailable options:")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
 
+	switch *optOutput {
+	case "text", "json", "yaml":
+	default:
+		log.Fatalf("bad output format %q", *optOutput)
+	}
+	switch *optTestOut {
+	case "":
+	case "hex", "json", "pcap":
+		if *optOutput != "text" {
+			log.Fatal("-testout can't be used with -o")
+		}
+		*optDryRun = true
+	default:
+		log.Fatalf("bad -testout format %q", *optTestOut)
+	}
+
+	a, err := newAnonymizer(*optAnonymize, *optPseudoKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	anon = a
+
+	var cid []byte
+	if *optCID != "" {
+		if cid, err = dhcp6c.ParseHex(*optCID); err != nil {
+			log.Fatal("bad client id: ", err)
+		}
+		if _, err := dhcpv6.DUIDFromBytes(cid); err != nil {
+			// sent anyway, but the echo of the server can't be parsed
+			log.Printf("warning: -cid is not a valid DUID (%v), the responses echoing it will be dropped as unparsable", err)
+		}
+	}
+
 	// parse prefix(es)
 	if optPrefixes == nil {
 		optPrefixes = append(optPrefixes, "::/64")
@@ -148,29 +319,242 @@ func main() {
 
 	logger := NewMyLogger()
 	logger.Debug = !*optNoDebug
-	logger.Anonymize = *optAnonymize
-	var client *dhcp6c.Client
-	client, err = dhcp6c.New(iface.Name,
-		dhcp6c.WithTimeout(2*time.Second),
+	logger.Anonymize = anon
+	clientOpts := []dhcp6c.ClientOpt{
+		dhcp6c.WithTimeout(2 * time.Second),
 		dhcp6c.WithRetry(1),
-		dhcp6c.WithLogger(&logger))
+	}
+	switch *optLog {
+	case "text":
+		clientOpts = append(clientOpts, dhcp6c.WithLogger(&logger))
+		if !*optNoDebug {
+			clientOpts = append(clientOpts, dhcp6c.WithLogDroppedPackets())
+		}
+	case "json":
+		// the packet dumps are replaced by the client events
+		level := slog.LevelDebug
+		if *optNoDebug {
+			level = slog.LevelWarn
+		}
+		handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: anon.attr,
+		})
+		clientOpts = append(clientOpts, dhcp6c.WithSlog(slog.New(handler)))
+	default:
+		log.Fatalf("bad log format %q", *optLog)
+	}
+	if *optPcap != "" {
+		f, err := os.Create(*optPcap)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pw, err := dhcp6c.NewPcapngWriter(f, strings.TrimSpace("testdhcpv6pd "+version))
+		if err != nil {
+			log.Fatal(err)
+		}
+		clientOpts = append(clientOpts, dhcp6c.WithCapture(func(p *dhcp6c.Packet) {
+			if anon.anonymizing() && !anon.capture(p) {
+				// it could leak what it can't parse
+				logger.Printf("malformed packet not captured")
+				return
+			}
+			if err := pw.WritePacket(p); err != nil {
+				logger.Printf("capture error: %v", err)
+			}
+		}))
+	}
+	if *optNoCheck {
+		clientOpts = append(clientOpts, dhcp6c.WithoutValidation())
+	}
+	if *optDSCP > 63 || *optHopLimit > 255 {
+		log.Fatal("bad DSCP or hop limit")
+	}
+	if *optHopLimit == 0 && *optDest == "site" {
+		// a hop limit of 1 doesn't leave the link, the scope bounds it
+		*optHopLimit = siteHopLimit
+	}
+	// socket options, the raw socket sets the IPv6 header fields itself
+	rawMode := *optRaw || *optVLAN != 0 || *optPCP != 0
+	if rawMode && (*optRcvBuf != 0 || *optMcastIf != "") {
+		// the AF_PACKET socket receives every frame and sends on the interface
+		log.Fatal("-rcvbuf and -mcastif can't be used with -raw, -vlan or -pcp")
+	}
+	if !rawMode {
+		if *optDSCP != 0 {
+			clientOpts = append(clientOpts, dhcp6c.WithTrafficClass(int(*optDSCP)<<2))
+		}
+		if *optHopLimit != 0 {
+			clientOpts = append(clientOpts, dhcp6c.WithMulticastHopLimit(int(*optHopLimit)))
+		}
+		if *optRcvBuf != 0 {
+			clientOpts = append(clientOpts, dhcp6c.WithReadBuffer(*optRcvBuf))
+		}
+		if *optMcastIf != "" {
+			mcastIf, err := parseInterface(*optMcastIf)
+			if err != nil {
+				log.Fatal(err)
+			}
+			clientOpts = append(clientOpts, dhcp6c.WithMulticastInterface(mcastIf))
+		}
+	}
+
+	// source address and port, not for the relay emulation which is a server
+	var src net.IP
+	if *optSrc != "" {
+		if src = net.ParseIP(*optSrc); src == nil || !src.IsLinkLocalUnicast() {
+			log.Fatalf("bad link-local address %q", *optSrc)
+		}
+	}
+	if *optPort <= 0 || *optPort > 65535 {
+		log.Fatal("bad port")
+	}
+
+	switch *optCoexist {
+	case "", "shared", "reuse":
+	default:
+		log.Fatalf("bad -coexist mode %q", *optCoexist)
+	}
+	if *optCoexist != "" && (*optRelay != "" || rawMode) {
+		// the relay emulation uses port 547, the raw socket doesn't bind
+		log.Fatal("-coexist can't be used with -relay or -raw")
+	}
+
+	var client *dhcp6c.Client
+	if *optRelay != "" {
+		// relay agent emulation: unicast to the server, replies come back on port 547
+		if *optDest != "link" {
+			log.Fatal("-dest can't be used with -relay")
+		}
+		if src != nil || *optWait > 0 || *optPort != dhcpv6.DefaultClientPort {
+			// a relay is bound to port 547 on all addresses
+			log.Fatal("-src, -wait and -port can't be used with -relay")
+		}
+		var relay dhcp6c.RelayConfig
+		var server *net.UDPAddr
+		relay, server, err = relayConfig(iface)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var conn net.PacketConn
+		conn, err = dhcp6c.NewRelayConn(dhcpv6.DefaultServerPort)
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err = dhcp6c.NewWithConn(conn, iface.HardwareAddr,
+			append(clientOpts, dhcp6c.WithRelay(relay), dhcp6c.WithBroadcastAddr(server))...)
+	} else {
+		var dest *net.UDPAddr
+		dest, err = destination(*optDest, iface)
+		if err != nil {
+			log.Fatal(err)
+		}
+		clientOpts = append(clientOpts, dhcp6c.WithBroadcastAddr(dest))
+		if (rawMode || *optCoexist == "shared") && *optWait > 0 && src == nil {
+			// these sockets don't bind, so New can't wait for the address
+			ctx, cancel := context.WithTimeout(context.Background(), *optWait)
+			src, err = dhcp6c.WaitLinkLocal(ctx, iface.Name)
+			cancel()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if rawMode {
+			// AF_PACKET socket, to control the 802.1Q header
+			if *optVLAN > 4094 || *optPCP > 7 {
+				log.Fatal("bad VLAN ID or priority")
+			}
+			if dest.IP.IsGlobalUnicast() {
+				// the frames go to the neighbor of the destination, not to a router
+				log.Fatal("-raw, -vlan and -pcp can't be used with a global unicast -dest")
+			}
+			var conn net.PacketConn
+			conn, err = dhcp6c.NewRawConn(iface.Name, dhcp6c.RawConfig{
+				SrcIP:        src,
+				Port:         *optPort,
+				VLAN:         uint16(*optVLAN),
+				Priority:     uint8(*optPCP),
+				TrafficClass: uint8(*optDSCP << 2),
+				HopLimit:     uint8(*optHopLimit),
+			})
+			if err != nil {
+				log.Fatal(err)
+			}
+			client, err = dhcp6c.NewWithConn(conn, iface.HardwareAddr, clientOpts...)
+		} else if *optCoexist == "shared" {
+			// raw IPv6 socket, gets a copy of the replies to the running client
+			if src == nil && dest.IP.IsGlobalUnicast() {
+				// routed server: a link-local source can't be routed
+				var probe net.Conn
+				if probe, err = net.Dial("udp6", dest.String()); err != nil {
+					log.Fatal(err)
+				}
+				src = probe.LocalAddr().(*net.UDPAddr).IP
+				probe.Close()
+			}
+			var conn net.PacketConn
+			conn, err = dhcp6c.NewSharedConn(iface.Name, src, *optPort)
+			if err != nil {
+				log.Fatal(err)
+			}
+			client, err = dhcp6c.NewWithConn(conn, iface.HardwareAddr, clientOpts...)
+		} else if dest.IP.IsGlobalUnicast() {
+			// routed server: bind a global source instead of the link-local one
+			if *optCoexist == "reuse" {
+				log.Fatal("-coexist reuse can't be used with a unicast -dest, use -coexist shared")
+			}
+			if src != nil || *optWait > 0 {
+				// the source is the global address the system selects
+				log.Fatal("-src and -wait can't be used with a global unicast -dest")
+			}
+			var conn net.PacketConn
+			conn, err = dhcp6c.NewIPv6UDPConnTo(dest, *optPort)
+			if err != nil {
+				log.Fatal(err)
+			}
+			client, err = dhcp6c.NewWithConn(conn, iface.HardwareAddr, clientOpts...)
+		} else {
+			if *optWait > 0 {
+				clientOpts = append(clientOpts, dhcp6c.WithLinkLocalWait(*optWait))
+			}
+			if src != nil {
+				clientOpts = append(clientOpts, dhcp6c.WithLocalAddr(src))
+			}
+			clientOpts = append(clientOpts, dhcp6c.WithLocalPort(*optPort))
+			if *optCoexist == "reuse" {
+				clientOpts = append(clientOpts, dhcp6c.WithReusePort())
+			}
+			client, err = dhcp6c.New(iface.Name, clientOpts...)
+		}
+	}
 
+	var inUse *dhcp6c.PortInUseError
+	if errors.As(err, &inUse) {
+		log.Fatalf("%v: use -coexist shared, -raw, or stop it", err)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// MacOs/darwin needs Zone set to same interface or 'no route to host' error
-	// since this doesn't bother other OSes  , we generalize this
-	if true { // runtime.GOOS == "darwin" {
-		baddr := dhcp6c.AllDHCPRelayAgentsAndServers
-		baddr.Zone = iface.Name
-		dhcp6c.WithBroadcastAddr(baddr)(client)
+	// identity of another client
+	var imported *dhcp6c.ClientIdentity
+	if *optImport != "" {
+		format, path, _ := strings.Cut(*optImport, ":")
+		imported, err = dhcp6c.ImportClientIdentity(format, path, iface.Name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Printf("imported DUID %s and %d IAID(s) from %s", dhcp6c.FormatDUID(imported.DUID), len(imported.IAIDs), format)
 	}
+
 	// build solicit options
 	var modifiers []dhcpv6.Modifier
 	for i, prefix := range prefixes {
 		iaid := [4]byte{}
 		binary.BigEndian.PutUint32(iaid[:], uint32(i+1))
+		if imported != nil && i < len(imported.IAIDs) {
+			iaid = imported.IAIDs[i]
+		}
 		modifiers = append(modifiers, dhcp6c.WithIAPD(
 			iaid,
 			&dhcpv6.OptIAPrefix{
@@ -262,42 +646,124 @@ func main() {
 			UUID: uuid,
 		}
 	}
-	// disabled for now, as it's not conform to the rfc
-	// if *optCID != "" {
-	// 	mac, err := net.ParseMAC(*optCID)
-	// 	if err != nil {
-	// 		log.Fatal(err)
-	// 	}
-	// 	modifiers = append(modifiers, dhcpv6.WithClientID(&dhcpv6.DUIDLLT{
-	// 		HWType:        iana.HWTypeEthernet,
-	// 		Time:          dhcpv6.GetTime(),
-	// 		LinkLayerAddr: mac,
-	// 	}))
-	// }
+	// raw DUID, any type
+	if *optDUIDRaw != "" {
+		if DUIDset {
+			log.Fatal("DUID already specified")
+		}
+		DUIDset = true
+		duid, err = dhcp6c.ParseDUID(*optDUIDRaw)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	adv, err := Solicit(context.Background(), *optDryRun, duid, client, modifiers...)
+	// imported DUID
+	if imported != nil {
+		if DUIDset {
+			log.Fatal("DUID already specified")
+		}
+		DUIDset = true
+		duid = imported.DUID
+	}
 
-	// Summary() prints a verbose representation of the exchanged packets.
-	if adv != nil {
-		if adv.MessageType != dhcpv6.MessageTypeAdvertise {
-			log.Fatal("unexcepted message type")
+	// persistent DUID, created on first run then reused
+	if !DUIDset && *optDUID1T == 0 && *optDUIDFile != "" {
+		var created bool
+		duid, created, err = dhcp6c.LoadOrCreateDUID(*optDUIDFile, *optNewDUID, func() dhcpv6.DUID {
+			return dhcp6c.GenerateDUID(client.InterfaceAddr())
+		})
+		if err != nil {
+			log.Fatal(err)
 		}
-		opts := adv.GetOption(dhcpv6.OptionIAPD)
-		if opts == nil {
-			log.Fatal("no IAPD found")
+		if created {
+			logger.Printf("new DUID %s saved to %s", dhcp6c.FormatDUID(duid), *optDUIDFile)
 		}
-		for _, opt := range opts {
-			iapd := dhcpv6.OptIAPD{}
-			if err := iapd.FromBytes(opt.ToBytes()); err != nil {
-				log.Fatal("cant parse iadp")
+	} else if *optNewDUID {
+		log.Fatal("-newduid requires a DUID state file and no explicit DUID")
+	}
+
+	// fixed transaction ID
+	if *optXID != "" {
+		xid, err := dhcp6c.ParseHex(*optXID)
+		if err != nil || len(xid) != 3 {
+			log.Fatalf("bad transaction ID %q, 3 bytes expected", *optXID)
+		}
+		modifiers = append(modifiers, func(m dhcpv6.DHCPv6) {
+			if msg, ok := m.(*dhcpv6.Message); ok {
+				copy(msg.TransactionID[:], xid)
 			}
-			prefixes := iapd.Options.Prefixes()
-			if prefixes == nil {
-				log.Fatal("no prefix found")
+		})
+	}
+
+	// raw Client Identifier, replaces the one built from the DUID
+	if cid != nil {
+		modifiers = append(modifiers, dhcp6c.WithRawClientID(cid))
+	}
+
+	start := time.Now()
+	if *optAudit > 0 && !*optDryRun {
+		status, servers := audit(context.Background(), *optAudit, duid, client, modifiers...)
+		writeMetrics(*optMetrics, client)
+		if *optOutput != "text" {
+			solicit, _ := NewSolicit(duid, modifiers...)
+			res := newResult(iface.Name, solicit)
+			res.Servers = servers
+			printResult(res, client, start, nil)
+		}
+		os.Exit(status)
+	}
+
+	solicit, env, err := Solicit(context.Background(), *optDryRun, *optRapid, duid, client, modifiers...)
+	if *optTestOut != "" && err == nil {
+		// the IPv6 and 802.1Q header fields as the socket sets them
+		frame := dhcp6c.RawConfig{VLAN: uint16(*optVLAN), Priority: uint8(*optPCP), TrafficClass: uint8(*optDSCP << 2)}
+		if rawMode || client.RemoteAddr().IP.IsMulticast() {
+			frame.HopLimit = uint8(*optHopLimit)
+		}
+		if err := export(os.Stdout, *optTestOut, client, solicit, frame); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	writeMetrics(*optMetrics, client)
+	if *optOutput != "text" {
+		res := newResult(iface.Name, solicit)
+		res.DryRun = *optDryRun
+		if env != nil {
+			res.setResponse(env)
+		}
+		printResult(res, client, start, err)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Summary() prints a verbose representation of the exchanged packets.
+	if env != nil {
+		adv := env.Message
+		log.Printf("answer from %s on %s in %s", anon.ip(net.IP(env.Source.Addr().AsSlice())), env.Interface, env.RTT().Round(time.Microsecond))
+		switch adv.MessageType {
+		case dhcpv6.MessageTypeAdvertise:
+			if *optRapid {
+				log.Printf("got an Advertise: the server did not use rapid commit, a Request/Reply exchange would be needed")
 			}
-			for _, p := range prefixes {
-				log.Printf("got a prefix = %s (pttl=%s,vttl=%s)\n", utils.AnonymizeIPNet(p.Prefix, utils.FormatV4First, *optAnonymize), p.PreferredLifetime, p.ValidLifetime)
+		case dhcpv6.MessageTypeReply:
+			if adv.GetOneOption(dhcpv6.OptionRapidCommit) != nil {
+				log.Printf("got a Reply with Rapid Commit: the server committed the binding in two messages")
+			} else {
+				log.Printf("got a Reply without the Rapid Commit option (not RFC 8415 compliant)")
 			}
+		default:
+			log.Fatal("unexcepted message type")
+		}
+		lease, leaseErr := leaseSummary(adv)
+		for _, line := range lease {
+			log.Print(line)
+		}
+		if leaseErr != nil {
+			log.Fatal(leaseErr)
 		}
 	}
 	// error handling is done *after* printing, so we still print the
@@ -307,6 +773,178 @@ func main() {
 	}
 }
 
+// printResult prints res to stdout in the -o format, with the counters of c
+// and the outcome.
+func printResult(res *result, c *dhcp6c.Client, start time.Time, err error) {
+	res.Retransmissions = c.Stats().Retransmissions
+	res.ElapsedMS = milliseconds(time.Since(start))
+	if err != nil {
+		res.Error = anon.text(err.Error())
+	}
+	if err := res.write(os.Stdout, *optOutput); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeMetrics writes the stats of c to path, if not empty, in the Prometheus
+// text format. The file is replaced atomically as the node_exporter textfile
+// collector requires.
+func writeMetrics(path string, c *dhcp6c.Client) {
+	if path == "" {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err == nil {
+		// readable by the exporter, CreateTemp uses 0600
+		if err = f.Chmod(0644); err == nil {
+			err = c.Stats().WritePrometheus(f)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), path)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		log.Printf("can't write the metrics: %v", err)
+	}
+}
+
+// exitUnknownServer is the exit status of the audit mode when a server is not in the allowlist
+const exitUnknownServer = 3
+
+// parseAllowlist returns the server DUIDs of -allow
+func parseAllowlist(allow string) ([][]byte, error) {
+	list := strings.Split(allow, ",")
+	if path, ok := strings.CutPrefix(allow, "@"); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		list = strings.Split(string(b), "\n")
+	}
+	var duids [][]byte
+	for _, s := range list {
+		s, _, _ = strings.Cut(s, "#")
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		duid, err := dhcp6c.ParseDUID(s)
+		if err != nil {
+			return nil, err
+		}
+		duids = append(duids, duid.ToBytes())
+	}
+	return duids, nil
+}
+
+// audit solicits during window, prints every server which answered and
+// returns the exit status and the servers for -o
+func audit(ctx context.Context, window time.Duration, duid dhcpv6.DUID, c *dhcp6c.Client, modifiers ...dhcpv6.Modifier) (int, []*serverInfo) {
+	var allowed [][]byte
+	if *optAllow != "" {
+		var err error
+		if allowed, err = parseAllowlist(*optAllow); err != nil {
+			log.Fatal("bad allowlist: ", err)
+		}
+	}
+
+	log.Printf("auditing DHCPv6 servers for %s", window)
+	responders, err := c.Audit(ctx, window, func() (*dhcpv6.Message, error) {
+		return NewSolicit(duid, modifiers...)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	status := 0
+	servers := []*serverInfo{}
+	for _, r := range responders {
+		serverID := "none"
+		known := false
+		if r.ServerID != nil {
+			serverID = anon.duid(dhcp6c.FormatDUID(r.ServerID))
+			for _, a := range allowed {
+				known = known || bytes.Equal(a, r.ServerID.ToBytes())
+			}
+		}
+		mac := "unknown"
+		if r.HWAddr != nil {
+			mac = anon.mac(r.HWAddr)
+		}
+		verdict := ""
+		if *optAllow != "" {
+			verdict = " [allowed]"
+			if !known {
+				verdict = " [UNKNOWN]"
+				status = exitUnknownServer
+			}
+		}
+		if *optOutput != "text" {
+			server := &serverInfo{Address: anon.ip(r.Addr), Preference: &r.Preference, Messages: r.Count}
+			if r.ServerID != nil {
+				server.DUID = serverID
+			}
+			if r.HWAddr != nil {
+				server.MAC = mac
+			}
+			if *optAllow != "" {
+				server.Allowed = &known
+			}
+			if r.Invalid != nil {
+				server.Invalid = anon.text(r.Invalid.Error())
+			}
+			for _, p := range r.Prefixes {
+				server.Prefixes = append(server.Prefixes, newPrefixInfo(p))
+			}
+			servers = append(servers, server)
+			continue
+		}
+		if r.Invalid != nil {
+			verdict += " [INVALID: " + anon.text(r.Invalid.Error()) + "]"
+		}
+		log.Printf("server %s mac %s duid %s preference %d: %d message(s)%s",
+			anon.ip(r.Addr), mac, serverID, r.Preference, r.Count, verdict)
+		for _, p := range r.Prefixes {
+			log.Printf("  offered prefix = %s (pttl=%s,vttl=%s)", anon.prefix(p.Prefix), p.PreferredLifetime, p.ValidLifetime)
+		}
+	}
+	if *optOutput == "text" {
+		log.Printf("%d server(s) found", len(responders))
+	}
+	return status, servers
+}
+
+// leaseSummary returns the prefixes delegated by an Advertise or a Reply,
+// one line each, and an error if there is none.
+func leaseSummary(msg *dhcpv6.Message) ([]string, error) {
+	iapds := msg.Options.IAPD()
+	if iapds == nil {
+		if st := msg.Options.Status(); st != nil {
+			return nil, fmt.Errorf("no IAPD found, status %s: %q", st.StatusCode, st.StatusMessage)
+		}
+		return nil, errors.New("no IAPD found")
+	}
+	var lines []string
+	for _, iapd := range iapds {
+		prefixes := iapd.Options.Prefixes()
+		if prefixes == nil {
+			if st := iapd.Options.Status(); st != nil {
+				return lines, fmt.Errorf("no prefix found, status %s: %q", st.StatusCode, st.StatusMessage)
+			}
+			return lines, errors.New("no prefix found")
+		}
+		for _, p := range prefixes {
+			lines = append(lines, fmt.Sprintf("got a prefix = %s (pttl=%s,vttl=%s)", anon.prefix(p.Prefix), p.PreferredLifetime, p.ValidLifetime))
+		}
+	}
+	return lines, nil
+}
+
 // NewSolicit creates a new SOLICIT message with given duid
 // derive the IAID in the IA_NA option.
 func NewSolicit(duid dhcpv6.DUID, modifiers ...dhcpv6.Modifier) (*dhcpv6.Message, error) {
@@ -332,19 +970,23 @@ func NewSolicit(duid dhcpv6.DUID, modifiers ...dhcpv6.Modifier) (*dhcpv6.Message
 }
 
 // Solicit sends a solicitation message and returns the first valid
-// advertisement received.
-func Solicit(ctx context.Context, dryRun bool, duid dhcpv6.DUID, c *dhcp6c.Client, modifiers ...dhcpv6.Modifier) (*dhcpv6.Message, error) {
+// advertisement received, with its envelope.
+// With rapidCommit, the Rapid Commit option is added and the first valid
+// advertisement or reply is returned.
+func Solicit(ctx context.Context, dryRun bool, rapidCommit bool, duid dhcpv6.DUID, c *dhcp6c.Client, modifiers ...dhcpv6.Modifier) (*dhcpv6.Message, *dhcp6c.Envelope, error) {
+	match := dhcp6c.IsMessageType(dhcpv6.MessageTypeAdvertise)
+	if rapidCommit {
+		modifiers = append(modifiers, dhcpv6.WithRapidCommit)
+		match = dhcp6c.IsMessageType(dhcpv6.MessageTypeReply, dhcpv6.MessageTypeAdvertise)
+	}
 	solicit, err := NewSolicit(duid, modifiers...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if dryRun {
 		c.PrintMessage("will send:", solicit)
-		return nil, nil
-	}
-	msg, err := c.SendAndRead(ctx, c.RemoteAddr(), solicit, dhcp6c.IsMessageType(dhcpv6.MessageTypeAdvertise))
-	if err != nil {
-		return nil, err
+		return solicit, nil, nil
 	}
-	return msg, nil
+	env, err := c.SendAndReadEnvelope(ctx, c.RemoteAddr(), solicit, dhcp6c.MatchMessage(match))
+	return solicit, env, err
 }
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	dhcp6c "github.com/nspeed-app/testdhcpv6pd"
+)
+
+// result is the outcome of a run, printed by -o json or yaml. The durations
+// are in seconds, except the _ms ones.
+type result struct {
+	Interface   string     `json:"interface"`
+	ClientDUID  string     `json:"client_duid,omitempty"`
+	Requested   []iapdInfo `json:"requested"`
+	RapidCommit bool       `json:"rapid_commit"`
+	DryRun      bool       `json:"dry_run,omitempty"`
+
+	Server   *serverInfo   `json:"server,omitempty"`
+	Response *responseInfo `json:"response,omitempty"`
+	// Servers are the responders of the audit mode.
+	Servers []*serverInfo `json:"servers,omitempty"`
+
+	Retransmissions uint64  `json:"retransmissions"`
+	ElapsedMS       float64 `json:"elapsed_ms"`
+	Error           string  `json:"error,omitempty"`
+}
+
+type serverInfo struct {
+	Address    string `json:"address"`
+	Interface  string `json:"interface,omitempty"`
+	DUID       string `json:"duid,omitempty"`
+	MAC        string `json:"mac,omitempty"`
+	Preference *uint8 `json:"preference,omitempty"`
+	// audit mode
+	Messages int          `json:"messages,omitempty"`
+	Allowed  *bool        `json:"allowed,omitempty"`
+	Invalid  string       `json:"invalid,omitempty"`
+	Prefixes []prefixInfo `json:"prefixes,omitempty"`
+}
+
+type responseInfo struct {
+	MessageType   string       `json:"message_type"`
+	TransactionID string       `json:"transaction_id"`
+	RTTMS         float64      `json:"rtt_ms"`
+	Status        *statusInfo  `json:"status,omitempty"`
+	IAPD          []iapdInfo   `json:"ia_pd"`
+	Options       []optionInfo `json:"options"`
+}
+
+type iapdInfo struct {
+	IAID     string       `json:"iaid"`
+	T1       uint32       `json:"t1"`
+	T2       uint32       `json:"t2"`
+	Status   *statusInfo  `json:"status,omitempty"`
+	Prefixes []prefixInfo `json:"prefixes"`
+}
+
+type prefixInfo struct {
+	Prefix            string      `json:"prefix"`
+	PreferredLifetime uint32      `json:"preferred_lifetime"`
+	ValidLifetime     uint32      `json:"valid_lifetime"`
+	Status            *statusInfo `json:"status,omitempty"`
+}
+
+type statusInfo struct {
+	Code    uint16 `json:"code"`
+	Name    string `json:"name"`
+	Message string `json:"message,omitempty"`
+}
+
+type optionInfo struct {
+	Code  uint16 `json:"code"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Data and Message are only set by -testout json: the option bytes in
+	// hex, and the message of a Relay Message option.
+	Data    string       `json:"data,omitempty"`
+	Message *messageInfo `json:"message,omitempty"`
+}
+
+// newResult returns the result of sending msg on iface, the response is
+// added by setResponse.
+func newResult(iface string, msg *dhcpv6.Message) *result {
+	r := &result{Interface: iface, Requested: []iapdInfo{}}
+	if msg == nil {
+		return r
+	}
+	if duid := msg.Options.ClientID(); duid != nil {
+		r.ClientDUID = anon.duid(dhcp6c.FormatDUID(duid))
+	}
+	r.RapidCommit = msg.GetOneOption(dhcpv6.OptionRapidCommit) != nil
+	for _, iapd := range msg.Options.IAPD() {
+		r.Requested = append(r.Requested, newIAPDInfo(iapd))
+	}
+	return r
+}
+
+// setResponse adds the response e and the server which sent it.
+func (r *result) setResponse(e *dhcp6c.Envelope) {
+	msg := e.Message
+	r.Server = &serverInfo{
+		Address:   anon.ip(e.Source.Addr().AsSlice()),
+		Interface: e.Interface,
+	}
+	if duid := msg.Options.ServerID(); duid != nil {
+		r.Server.DUID = anon.duid(dhcp6c.FormatDUID(duid))
+	}
+	if opt, ok := msg.GetOneOption(dhcpv6.OptionPreference).(*dhcpv6.OptionGeneric); ok && len(opt.OptionData) == 1 {
+		r.Server.Preference = &opt.OptionData[0]
+	}
+
+	r.Response = &responseInfo{
+		MessageType:   msg.MessageType.String(),
+		TransactionID: msg.TransactionID.String(),
+		RTTMS:         milliseconds(e.RTT()),
+		Status:        newStatusInfo(msg.Options.Status()),
+		IAPD:          []iapdInfo{},
+		Options:       []optionInfo{},
+	}
+	for _, iapd := range msg.Options.IAPD() {
+		r.Response.IAPD = append(r.Response.IAPD, newIAPDInfo(iapd))
+	}
+	for _, opt := range msg.Options.Options {
+		r.Response.Options = append(r.Response.Options, optionInfo{
+			Code:  uint16(opt.Code()),
+			Name:  opt.Code().String(),
+			Value: anon.text(opt.String()),
+		})
+	}
+}
+
+func newIAPDInfo(iapd *dhcpv6.OptIAPD) iapdInfo {
+	info := iapdInfo{
+		IAID:     anon.iaid(iapd.IaId),
+		T1:       seconds(iapd.T1),
+		T2:       seconds(iapd.T2),
+		Status:   newStatusInfo(iapd.Options.Status()),
+		Prefixes: []prefixInfo{},
+	}
+	for _, p := range iapd.Options.Prefixes() {
+		info.Prefixes = append(info.Prefixes, newPrefixInfo(p))
+	}
+	return info
+}
+
+func newPrefixInfo(p *dhcpv6.OptIAPrefix) prefixInfo {
+	info := prefixInfo{
+		PreferredLifetime: seconds(p.PreferredLifetime),
+		ValidLifetime:     seconds(p.ValidLifetime),
+		Status:            newStatusInfo(p.Options.Status()),
+	}
+	if p.Prefix != nil {
+		info.Prefix = anon.prefix(p.Prefix)
+	}
+	return info
+}
+
+func newStatusInfo(s *dhcpv6.OptStatusCode) *statusInfo {
+	if s == nil {
+		return nil
+	}
+	return &statusInfo{Code: uint16(s.StatusCode), Name: s.StatusCode.String(), Message: s.StatusMessage}
+}
+
+func seconds(d time.Duration) uint32 {
+	return uint32(d / time.Second)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// write writes r in format, json or yaml.
+func (r *result) write(w io.Writer, format string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == "yaml" {
+		return writeYAML(w, b)
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// writeYAML writes the JSON document data as a YAML block document, keeping
+// the order of the keys.
+func writeYAML(w io.Writer, data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var buf bytes.Buffer
+	if err := yamlValue(d, &buf, "", false); err != nil {
+		return err
+	}
+	// the document starts with a newline for the top-level mapping
+	_, err := w.Write(bytes.TrimPrefix(buf.Bytes(), []byte("\n")))
+	return err
+}
+
+// yamlValue writes the next value of d, after a "key:" or a "-" when inList.
+func yamlValue(d *json.Decoder, w *bytes.Buffer, indent string, inList bool) error {
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		if !d.More() {
+			w.WriteString(" {}\n")
+			_, err = d.Token()
+			return err
+		}
+		for first := true; d.More(); first = false {
+			key, err := d.Token()
+			if err != nil {
+				return err
+			}
+			switch {
+			case first && inList:
+				w.WriteString(" ")
+			case first:
+				w.WriteString("\n" + indent)
+			default:
+				w.WriteString(indent)
+			}
+			w.WriteString(yamlKey(key.(string)) + ":")
+			if err := yamlValue(d, w, indent+"  ", false); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		if !d.More() {
+			w.WriteString(" []\n")
+			_, err = d.Token()
+			return err
+		}
+		w.WriteString("\n")
+		for d.More() {
+			w.WriteString(indent + "-")
+			if err := yamlValue(d, w, indent+"  ", true); err != nil {
+				return err
+			}
+		}
+	default:
+		w.WriteString(" " + yamlScalar(tok) + "\n")
+		return nil
+	}
+	_, err = d.Token() // closing delimiter
+	return err
+}
+
+// reYAMLKey matches the keys which need no quotes
+var reYAMLKey = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func yamlKey(key string) string {
+	if reYAMLKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+// yamlScalar formats a JSON scalar, the strings are always quoted: a prefix
+// or a "no" must stay a string.
+func yamlScalar(tok json.Token) string {
+	switch v := tok.(type) {
+	case string:
+		return strconv.Quote(v)
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,162 @@
+package dhcp6c
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// PortInUseError is returned when the client port is already bound, usually
+// by the DHCPv6 client of the system (dhcpcd, odhcp6c, systemd-networkd...).
+type PortInUseError struct {
+	Port int
+	// Process and PID of the owner of the port, if found (Linux only, and
+	// the sockets of other users are only visible to root).
+	Process string
+	PID     int
+	Err     error
+}
+
+func (e *PortInUseError) Error() string {
+	if e.Process != "" {
+		return fmt.Sprintf("port %d is already in use by %s (pid %d), a DHCPv6 client is probably running", e.Port, e.Process, e.PID)
+	}
+	return fmt.Sprintf("port %d is already in use, a DHCPv6 client is probably running", e.Port)
+}
+
+func (e *PortInUseError) Unwrap() error {
+	return e.Err
+}
+
+// portInUse returns a PortInUseError if err is a bind failure of port
+// because it is already in use, err otherwise.
+func portInUse(port int, err error) error {
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return err
+	}
+	process, pid := portOwner(port)
+	return &PortInUseError{Port: port, Process: process, PID: pid, Err: err}
+}
+
+// listenUDP binds a UDP socket to ip and port on iface. With reuse, the port
+// can be shared with another socket which also set SO_REUSEADDR or
+// SO_REUSEPORT.
+func listenUDP(ip net.IP, port int, iface string, reuse bool) (net.PacketConn, error) {
+	var lc net.ListenConfig
+	if reuse {
+		lc.Control = reusePortControl
+	}
+	addr := &net.UDPAddr{IP: ip, Port: port, Zone: iface}
+	conn, err := lc.ListenPacket(context.Background(), "udp6", addr.String())
+	if err != nil {
+		return nil, portInUse(port, err)
+	}
+	return conn, nil
+}
+
+// WithReusePort sets SO_REUSEADDR and SO_REUSEPORT on the socket bound by
+// New, so it can share port 546 with a running DHCPv6 client. It only
+// works if that client set the same option, and the system then delivers
+// each reply to only one of the sockets: the probes may steal a reply from
+// the running client. See NewSharedConn for a passive alternative.
+//
+// Only implemented on Linux.
+func WithReusePort() ClientOpt {
+	return func(c *Client) {
+		c.reusePort = true
+	}
+}
+
+// SharedConn is a net.PacketConn sending and receiving UDP datagrams on a
+// raw IPv6 socket, so it doesn't bind the UDP port: the system still
+// delivers the datagrams to the UDP socket owning it, and SharedConn gets a
+// copy. Replies are told apart by their transaction ID.
+type SharedConn struct {
+	*net.IPConn
+	local *net.UDPAddr
+
+	// rmu serializes the readers of buf.
+	rmu sync.Mutex
+	buf []byte
+}
+
+// NewSharedConn returns a shared connection on iface, with src (default is
+// the link-local address of the interface) and port as source. It requires
+// the CAP_NET_RAW capability.
+//
+// Only implemented on Linux, other systems don't pass UDP to raw sockets.
+func NewSharedConn(iface string, src net.IP, port int) (*SharedConn, error) {
+	if src == nil {
+		var err error
+		if src, err = dhcpv6.GetLinkLocalAddr(iface); err != nil {
+			return nil, err
+		}
+	}
+	lc := net.ListenConfig{Control: sharedControl(iface)}
+	conn, err := lc.ListenPacket(context.Background(), "ip6:udp", (&net.IPAddr{IP: src, Zone: iface}).String())
+	if err != nil {
+		return nil, err
+	}
+	return &SharedConn{
+		IPConn: conn.(*net.IPConn),
+		local:  &net.UDPAddr{IP: src, Port: port, Zone: iface},
+	}, nil
+}
+
+// ReadFrom implements net.PacketConn. Datagrams which are not for the local
+// port are skipped. As with a UDP socket, a datagram larger than b is
+// truncated to len(b) bytes.
+func (c *SharedConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	buf := readBuffer(&c.buf, udpHeaderLen+len(b))
+	for {
+		n, addr, err := c.IPConn.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n < udpHeaderLen || int(binary.BigEndian.Uint16(buf[2:])) != c.local.Port {
+			continue
+		}
+		udpLen := int(binary.BigEndian.Uint16(buf[4:]))
+		if udpLen > n && n == len(buf) {
+			// truncated by the read
+			udpLen = n
+		}
+		if udpLen < udpHeaderLen || udpLen > n {
+			continue
+		}
+		ip := addr.(*net.IPAddr)
+		from := &net.UDPAddr{IP: ip.IP, Port: int(binary.BigEndian.Uint16(buf)), Zone: ip.Zone}
+		return copy(b, buf[udpHeaderLen:udpLen]), from, nil
+	}
+}
+
+// WriteTo implements net.PacketConn, addr must be a *net.UDPAddr. The
+// system computes the UDP checksum.
+func (c *SharedConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	dst, ok := addr.(*net.UDPAddr)
+	if !ok || dst.IP.To4() != nil {
+		return 0, fmt.Errorf("bad destination %v", addr)
+	}
+	udp := make([]byte, udpHeaderLen, udpHeaderLen+len(b))
+	binary.BigEndian.PutUint16(udp, uint16(c.local.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderLen+len(b)))
+	udp = append(udp, b...)
+	if _, err := c.IPConn.WriteTo(udp, &net.IPAddr{IP: dst.IP, Zone: dst.Zone}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// LocalAddr implements net.PacketConn.
+func (c *SharedConn) LocalAddr() net.Addr {
+	return c.local
+}
@@ -0,0 +1,90 @@
+package dhcp6c
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortControl sets SO_REUSEADDR and SO_REUSEPORT before the bind.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		if serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); serr != nil {
+			return
+		}
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", serr)
+}
+
+// sharedControl binds the raw socket to iface and has the system compute
+// and check the UDP checksum (at offset 6 in the UDP header).
+func sharedControl(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			if serr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface); serr != nil {
+				return
+			}
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_CHECKSUM, 6)
+		})
+		if err != nil {
+			return err
+		}
+		return os.NewSyscallError("setsockopt", serr)
+	}
+}
+
+// portOwner returns the name and PID of the process owning the UDP port,
+// or "" if not found.
+func portOwner(port int) (string, int) {
+	inodes := make(map[string]bool)
+	for _, name := range []string{"/proc/net/udp6", "/proc/net/udp"} {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		s := bufio.NewScanner(f)
+		s.Scan() // header
+		for s.Scan() {
+			// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+			fields := strings.Fields(s.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			_, p, _ := strings.Cut(fields[1], ":")
+			if v, err := strconv.ParseUint(p, 16, 16); err == nil && int(v) == port {
+				inodes[fmt.Sprintf("socket:[%s]", fields[9])] = true
+			}
+		}
+		f.Close()
+	}
+	if len(inodes) == 0 {
+		return "", 0
+	}
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err != nil || !inodes[link] {
+			continue
+		}
+		dir := filepath.Dir(filepath.Dir(fd))
+		pid, _ := strconv.Atoi(filepath.Base(dir))
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			return "", 0
+		}
+		return strings.TrimSpace(string(comm)), pid
+	}
+	return "", 0
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package dhcp6c
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errCoexist = errors.New("sharing the client port is only supported on Linux")
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errCoexist
+}
+
+func sharedControl(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errCoexist
+	}
+}
+
+// portOwner is not implemented on this platform.
+func portOwner(port int) (string, int) {
+	return "", 0
+}
@@ -16,14 +16,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"os"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv6"
+	"golang.org/x/net/ipv6"
 )
 
 // Broadcast destination IP addresses as defined by RFC 3315
@@ -45,12 +46,15 @@ var (
 
 // pendingCh is a channel associated with a pending TransactionID.
 type pendingCh struct {
-	// SendAndRead closes done to indicate that it wishes for no more
-	// messages for this particular XID.
-	done <-chan struct{}
+	// ch is used by the receive loop to distribute DHCP messages. It is
+	// never blocking: the messages are dropped when it is full.
+	ch chan<- *Envelope
 
-	// ch is used by the receive loop to distribute DHCP messages.
-	ch chan<- *dhcpv6.Message
+	// sent is the message the responses are validated against.
+	sent *dhcpv6.Message
+	// keepInvalid passes the invalid responses with Envelope.Invalid set,
+	// instead of dropping them.
+	keepInvalid bool
 }
 
 // Client is a DHCPv6 client.
@@ -64,16 +68,34 @@ type Client struct {
 	// bufferCap is the channel capacity for each TransactionID.
 	bufferCap int
 
+	// maxPacketSize is the size of the largest datagram received, bufs
+	// are the read buffers.
+	maxPacketSize int
+	bufs          sync.Pool
+
+	// dropped counts the messages dropped because the channel of their
+	// TransactionID was full.
+	dropped atomic.Uint64
+
+	// metrics are the counters of Stats.
+	metrics metrics
+
+	// capture is called with the datagrams sent and received, if not nil.
+	capture func(p *Packet)
+
 	// serverAddr is the UDP address to send all packets to.
 	//
 	// This may be an actual broadcast address, or a unicast address.
 	serverAddr *net.UDPAddr
 
-	// closed is an atomic bool set to 1 when done is closed.
+	// closed is an atomic bool set to 1 by Close.
 	closed uint32
 
-	// done is closed to unblock the receive loop.
-	done chan struct{}
+	// done is closed when the receive loop exits, after setting err, to
+	// fail the pending exchanges.
+	done  chan struct{}
+	errMu sync.Mutex
+	err   error
 
 	// wg protects the receiveLoop.
 	wg sync.WaitGroup
@@ -81,6 +103,38 @@ type Client struct {
 	// printDropped logs dropped packets to logger if true.
 	printDropped bool
 
+	// slog receives the structured events if not nil, see WithSlog.
+	slog *slog.Logger
+
+	// noValidation disables the checks of the responses, see validate.
+	noValidation bool
+
+	// relay enables the relay agent emulation if not nil.
+	relay *RelayConfig
+
+	// connSetup configures the connection, see WithTrafficClass & co.
+	connSetup []func(conn net.PacketConn) error
+
+	// linkLocalWait is how long New waits for a usable link-local address.
+	linkLocalWait time.Duration
+
+	// localAddr and localPort are the address and port bound by New.
+	localAddr net.IP
+	localPort int
+	reusePort bool
+
+	// rxMeta is set when the connection reports the receiving interface and
+	// the kernel timestamp of the datagrams, in the control messages read
+	// into oob. ifnames caches the names of the receiving interfaces, by
+	// index. They are only used by the receive loop.
+	rxMeta  bool
+	oob     []byte
+	ifnames map[int]string
+
+	subMu sync.Mutex
+	// subs are the subscribers to the unsolicited messages, see Subscribe.
+	subs map[*subscriber]struct{}
+
 	pendingMu sync.Mutex
 	// pending stores the distribution channels for each pending
 	// TransactionID. receiveLoop uses this map to determine which channel
@@ -128,38 +182,90 @@ func NewIPv6UDPConn(iface string, port int) (net.PacketConn, error) {
 		return nil, err
 	}
 
-	return net.ListenUDP("udp6", &net.UDPAddr{
-		IP:   ip,
+	return listenUDP(ip, port, iface, false)
+}
+
+// NewIPv6UDPConnTo returns a UDP connection bound to port and to the source
+// address the system selects to reach server. Unicasting to a server which
+// is not on-link requires a global source, a link-local one can't be routed.
+func NewIPv6UDPConnTo(server *net.UDPAddr, port int) (net.PacketConn, error) {
+	probe, err := net.DialUDP("udp6", nil, server)
+	if err != nil {
+		return nil, err
+	}
+	src := probe.LocalAddr().(*net.UDPAddr)
+	probe.Close()
+
+	conn, err := net.ListenUDP("udp6", &net.UDPAddr{
+		IP:   src.IP,
 		Port: port,
-		Zone: iface,
+		Zone: src.Zone,
 	})
+	if err != nil {
+		return nil, portInUse(port, err)
+	}
+	return conn, nil
 }
 
 // New returns a new DHCPv6 client for the given network interface.
 func New(iface string, opts ...ClientOpt) (*Client, error) {
-	c, err := NewIPv6UDPConn(iface, dhcpv6.DefaultClientPort)
+	i, err := net.InterfaceByName(iface)
 	if err != nil {
 		return nil, err
 	}
 
-	i, err := net.InterfaceByName(iface)
-	if err != nil {
+	c := newClient(nil, i.HardwareAddr, opts...)
+	if c.conn == nil {
+		ip := c.localAddr
+		switch {
+		case c.linkLocalWait > 0:
+			ctx, cancel := context.WithTimeout(context.Background(), c.linkLocalWait)
+			ip, err = waitLinkLocalAddr(ctx, iface, c.localAddr)
+			cancel()
+		case ip != nil:
+			err = checkLinkLocal(iface, ip)
+		default:
+			ip, err = dhcpv6.GetLinkLocalAddr(iface)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.conn, err = listenUDP(ip, c.localPort, iface, c.reusePort); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.start(); err != nil {
+		c.conn.Close()
 		return nil, err
 	}
-	return NewWithConn(c, i.HardwareAddr, opts...)
+	return c, nil
 }
 
 // NewWithConn creates a new DHCP client that sends and receives packets on the
 // given interface.
 func NewWithConn(conn net.PacketConn, ifaceHWAddr net.HardwareAddr, opts ...ClientOpt) (*Client, error) {
+	c := newClient(conn, ifaceHWAddr, opts...)
+	if c.conn == nil {
+		return nil, fmt.Errorf("require a connection")
+	}
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient returns a client configured with opts, not started yet.
+func newClient(conn net.PacketConn, ifaceHWAddr net.HardwareAddr, opts ...ClientOpt) *Client {
 	c := &Client{
-		ifaceHWAddr: ifaceHWAddr,
-		timeout:     5 * time.Second,
-		retry:       3,
-		serverAddr:  AllDHCPRelayAgentsAndServers,
-		bufferCap:   5,
-		conn:        conn,
-		logger:      emptyLogger{},
+		ifaceHWAddr:   ifaceHWAddr,
+		timeout:       5 * time.Second,
+		retry:         3,
+		serverAddr:    AllDHCPRelayAgentsAndServers,
+		bufferCap:     5,
+		maxPacketSize: 1500,
+		localPort:     dhcpv6.DefaultClientPort,
+		conn:          conn,
+		logger:        emptyLogger{},
 
 		done:    make(chan struct{}),
 		pending: make(map[dhcpv6.TransactionID]*pendingCh),
@@ -168,13 +274,28 @@ func NewWithConn(conn net.PacketConn, ifaceHWAddr net.HardwareAddr, opts ...Clie
 	for _, opt := range opts {
 		opt(c)
 	}
+	c.bufs.New = func() any {
+		// one more byte to detect the larger datagrams
+		b := make([]byte, c.maxPacketSize+1)
+		return &b
+	}
+	return c
+}
 
-	if c.conn == nil {
-		return nil, fmt.Errorf("require a connection")
+// start configures the connection and starts the receive loop.
+func (c *Client) start() error {
+	for _, setup := range c.connSetup {
+		if err := setup(c.conn); err != nil {
+			return err
+		}
+	}
+	if uc, ok := c.conn.(*net.UDPConn); ok {
+		c.rxMeta = enableRxMeta(uc) == nil
+		c.oob = make([]byte, 128) // only used by the receive loop
 	}
 
 	c.receiveLoop()
-	return c, nil
+	return nil
 }
 
 // Close closes the underlying connection.
@@ -184,74 +305,128 @@ func (c *Client) Close() error {
 		return nil
 	}
 
+	// The receive loop exits as the connection is closed, which closes
+	// c.done and unblocks any SendAndRead.
 	err := c.conn.Close()
 
-	// Closing c.done sets off a chain reaction:
-	//
-	// Any SendAndRead unblocks trying to receive more messages, which
-	// means rem() gets called.
-	//
-	// rem() should be unblocking receiveLoop if it is blocked.
-	//
-	// receiveLoop should then exit gracefully.
-	close(c.done)
-
 	// Wait for receiveLoop to stop.
 	c.wg.Wait()
 
 	return err
 }
 
+// Done returns a channel closed when the client stops receiving, because
+// it is closed or the connection failed. Err then returns why.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil while the client is receiving, net.ErrClosed once it is
+// closed, or the error which stopped the receive loop. The pending and
+// later exchanges fail with it.
+func (c *Client) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
 func isErrClosing(err error) bool {
-	// Unfortunately, the epoll-connection-closed error is internal to the
-	// net library.
-	return strings.Contains(err.Error(), "use of closed network connection")
+	return errors.Is(err, net.ErrClosed)
 }
 
 func (c *Client) receiveLoop() {
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
+		// after done is closed, so no subscriber is added later
+		defer c.stopSubscribers()
+		defer close(c.done)
 		for {
-			// TODO: Clients can send a "max packet size" option in their
-			// packets, IIRC. Choose a reasonable size and set it.
-			b := make([]byte, 1500)
-			n, _, err := c.conn.ReadFrom(b)
+			bp := c.bufs.Get().(*[]byte)
+			b := *bp
+			n, peer, ifindex, ts, err := c.read(b)
 			if err != nil {
-				if !isErrClosing(err) {
+				if isErrClosing(err) {
+					err = net.ErrClosed
+				} else {
 					c.logger.Printf("error reading from UDP connection: %v", err)
+					err = fmt.Errorf("error reading from connection: %w", err)
+					c.slogError(err)
 				}
+				c.errMu.Lock()
+				c.err = err
+				c.errMu.Unlock()
 				return
 			}
+			ifname := c.interfaceName(peer, ifindex)
+			c.captureReceived(b[:n], peer, ifname, ts)
+			if n > c.maxPacketSize {
+				if c.printDropped {
+					c.logger.Printf("Message larger than %d bytes dropped", c.maxPacketSize)
+				}
+				c.slogDrop("too large", nil, peer)
+				c.metrics.add(&c.metrics.stats.Malformed)
+				c.bufs.Put(bp)
+				continue
+			}
 
-			msg, err := dhcpv6.MessageFromBytes(b[:n])
+			// the message doesn't reference b, it can be reused
+			msg, err := c.decapsulate(b[:n])
 			if err != nil {
 				// Not a valid DHCP packet; keep listening.
 				if c.printDropped {
-					if len(b) > 12 {
-						b = b[:12]
-					}
-					c.logger.Printf("Invalid DHCPv6 message received (len %d bytes), first 12 bytes: %#x", n, b)
+					c.logger.Printf("Invalid DHCPv6 message received (len %d bytes), first 12 bytes: %#x", n, b[:min(n, 12)])
 				}
+				c.slogDrop("malformed", nil, peer)
+				c.metrics.add(&c.metrics.stats.Malformed)
+				c.bufs.Put(bp)
 				continue
 			}
+			c.bufs.Put(bp)
+			c.metrics.count(&c.metrics.stats.Received, msg.MessageType)
 
 			c.pendingMu.Lock()
 			p, ok := c.pending[msg.TransactionID]
-			if ok {
-				select {
-				case <-p.done:
-					close(p.ch)
-					delete(c.pending, msg.TransactionID)
+			var invalid error
+			var unsolicited *Envelope
+			if ok && !c.noValidation {
+				invalid = validate(p.sent, msg)
+			}
+			switch {
+			case invalid != nil && !p.keepInvalid:
+				if c.printDropped {
+					c.logger.Printf("Invalid %s from %s dropped: %v", msg.MessageType, peer, invalid)
+				}
+				c.slogDrop(invalid.Error(), msg, peer)
+				c.metrics.add(&c.metrics.stats.Invalid)
 
-				// This send may block.
-				case p.ch <- msg:
+			case ok:
+				e := c.newEnvelope(msg, peer, ifname, ts)
+				e.Invalid = invalid
+				select {
+				case p.ch <- e:
+				default:
+					// a slow consumer must not stall the others
+					c.dropped.Add(1)
+					if c.printDropped {
+						c.logger.Printf("Queue full for XID %s, %s dropped", msg.TransactionID, msg.MessageType)
+					}
+					c.slogDrop("queue full", msg, peer)
 				}
-			} else if c.printDropped {
-				// The Stringer will print the transaction ID.
-				c.logger.Printf("No client waiting for msg with this XID: %s", msg)
+
+			default:
+				unsolicited = c.newEnvelope(msg, peer, ifname, ts)
 			}
 			c.pendingMu.Unlock()
+
+			if unsolicited != nil && !c.dispatch(unsolicited) {
+				if c.printDropped {
+					// The Stringer will print the transaction ID.
+					c.logger.Printf("No client waiting for msg with this XID: %s", msg)
+				}
+				c.slogDrop("no pending transaction", msg, peer)
+				c.metrics.add(&c.metrics.stats.Unsolicited)
+			}
 		}
 	}()
 }
@@ -268,6 +443,26 @@ func WithTimeout(d time.Duration) ClientOpt {
 	}
 }
 
+// WithQueueSize sets the number of responses queued for each transaction,
+// the next ones are dropped until the caller reads them.
+//
+// Default is 5.
+func WithQueueSize(n int) ClientOpt {
+	return func(c *Client) {
+		c.bufferCap = n
+	}
+}
+
+// WithMaxPacketSize sets the size of the largest message received, larger
+// messages are dropped.
+//
+// Default is 1500 bytes.
+func WithMaxPacketSize(size int) ClientOpt {
+	return func(c *Client) {
+		c.maxPacketSize = size
+	}
+}
+
 // WithLogDroppedPackets logs a short message for dropped packets.
 func WithLogDroppedPackets() ClientOpt {
 	return func(c *Client) {
@@ -298,6 +493,91 @@ func WithBroadcastAddr(n *net.UDPAddr) ClientOpt {
 	}
 }
 
+// WithLinkLocalWait makes New wait up to timeout for the interface to be up
+// with a usable (non tentative) link-local address, instead of failing right
+// after the interface is brought up.
+func WithLinkLocalWait(timeout time.Duration) ClientOpt {
+	return func(c *Client) {
+		c.linkLocalWait = timeout
+	}
+}
+
+// WithLocalAddr sets the link-local address bound by New, when the interface
+// has several (stable privacy and EUI-64 for instance).
+//
+// Default is the first link-local address of the interface.
+func WithLocalAddr(ip net.IP) ClientOpt {
+	return func(c *Client) {
+		c.localAddr = ip
+	}
+}
+
+// WithLocalPort sets the UDP port bound by New. A port other than 546 doesn't
+// require privileges, but only works with servers or relays replying to the
+// source port.
+//
+// Default is 546.
+func WithLocalPort(port int) ClientOpt {
+	return func(c *Client) {
+		c.localPort = port
+	}
+}
+
+// WithTrafficClass sets the IPv6 traffic class of the sent packets. The DSCP
+// is the 6 upper bits: tc = dscp << 2.
+func WithTrafficClass(tc int) ClientOpt {
+	return func(c *Client) {
+		c.connSetup = append(c.connSetup, func(conn net.PacketConn) error {
+			if err := ipv6.NewPacketConn(conn).SetTrafficClass(tc); err != nil {
+				return fmt.Errorf("can't set traffic class: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// WithMulticastHopLimit sets the hop limit of the multicast packets.
+//
+// Default is 1.
+func WithMulticastHopLimit(hoplim int) ClientOpt {
+	return func(c *Client) {
+		c.connSetup = append(c.connSetup, func(conn net.PacketConn) error {
+			if err := ipv6.NewPacketConn(conn).SetMulticastHopLimit(hoplim); err != nil {
+				return fmt.Errorf("can't set multicast hop limit: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// WithMulticastInterface sets the outgoing interface of the multicast packets.
+func WithMulticastInterface(iface *net.Interface) ClientOpt {
+	return func(c *Client) {
+		c.connSetup = append(c.connSetup, func(conn net.PacketConn) error {
+			if err := ipv6.NewPacketConn(conn).SetMulticastInterface(iface); err != nil {
+				return fmt.Errorf("can't set multicast interface: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// WithReadBuffer sets the size of the socket receive buffer.
+func WithReadBuffer(bytes int) ClientOpt {
+	return func(c *Client) {
+		c.connSetup = append(c.connSetup, func(conn net.PacketConn) error {
+			rb, ok := conn.(interface{ SetReadBuffer(int) error })
+			if !ok {
+				return fmt.Errorf("can't set read buffer on %T", conn)
+			}
+			if err := rb.SetReadBuffer(bytes); err != nil {
+				return fmt.Errorf("can't set read buffer: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
 // WithLogger logs DHCPv6 messages using provided logger.
 func WithLogger(logger Logger) ClientOpt {
 	return func(c *Client) {
@@ -341,6 +621,12 @@ func IsMessageType(t dhcpv6.MessageType, tt ...dhcpv6.MessageType) Matcher {
 	}
 }
 
+// Dropped returns the number of responses dropped because the queue of their
+// transaction was full, see WithQueueSize. Stats has the other counters.
+func (c *Client) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
 // RemoteAddr is the default DHCP server address this client sends messages to.
 func (c *Client) RemoteAddr() *net.UDPAddr {
 	// Make a copy so the caller cannot modify the address once the client
@@ -411,27 +697,26 @@ func (c *Client) Request(ctx context.Context, advertise *dhcpv6.Message, modifie
 // received.
 //
 // Responses will be matched by transaction ID.
-func (c *Client) send(dest net.Addr, msg *dhcpv6.Message) (<-chan *dhcpv6.Message, func(), error) {
+func (c *Client) send(dest net.Addr, msg *dhcpv6.Message, keepInvalid bool) (<-chan *Envelope, func(), error) {
+	select {
+	case <-c.done:
+		return nil, nil, c.Err()
+	default:
+	}
+
 	c.pendingMu.Lock()
 	if _, ok := c.pending[msg.TransactionID]; ok {
 		c.pendingMu.Unlock()
 		return nil, nil, fmt.Errorf("transaction ID %s already in use", msg.TransactionID)
 	}
 
-	ch := make(chan *dhcpv6.Message, c.bufferCap)
-	done := make(chan struct{})
-	c.pending[msg.TransactionID] = &pendingCh{done: done, ch: ch}
+	ch := make(chan *Envelope, c.bufferCap)
+	c.pending[msg.TransactionID] = &pendingCh{ch: ch, sent: msg, keepInvalid: keepInvalid}
 	c.pendingMu.Unlock()
 
 	cancel := func() {
-		// Why can't we just close ch here?
-		//
-		// Because receiveLoop may potentially be blocked trying to
-		// send on ch. We gotta unblock it first, so it'll unlock the
-		// lock, and then we can take the lock and remove the XID from
-		// the pending transaction map.
-		close(done)
-
+		// receiveLoop never blocks on ch while holding the lock, so ch
+		// can be closed once removed from the pending transactions.
 		c.pendingMu.Lock()
 		if p, ok := c.pending[msg.TransactionID]; ok {
 			close(p.ch)
@@ -440,10 +725,17 @@ func (c *Client) send(dest net.Addr, msg *dhcpv6.Message) (<-chan *dhcpv6.Messag
 		c.pendingMu.Unlock()
 	}
 
-	if _, err := c.conn.WriteTo(msg.ToBytes(), dest); err != nil {
+	b, err := c.encapsulate(msg)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if _, err := c.conn.WriteTo(b, dest); err != nil {
 		cancel()
 		return nil, nil, fmt.Errorf("error writing packet to connection: %v", err)
 	}
+	c.captureSent(b, dest, time.Now())
+	c.metrics.count(&c.metrics.stats.Sent, msg.MessageType)
 	return ch, cancel, nil
 }
 
@@ -455,19 +747,39 @@ var errDeadlineExceeded = errors.New("INTERNAL ERROR: deadline exceeded")
 //
 // If match is nil, the first packet matching the Transaction ID is returned.
 func (c *Client) SendAndRead(ctx context.Context, dest *net.UDPAddr, msg *dhcpv6.Message, match Matcher) (*dhcpv6.Message, error) {
-	var response *dhcpv6.Message
+	e, err := c.SendAndReadEnvelope(ctx, dest, msg, MatchMessage(match))
+	if err != nil {
+		return nil, err
+	}
+	return e.Message, nil
+}
+
+// SendAndReadEnvelope is SendAndRead returning the envelope of the response,
+// to know which server answered and when.
+//
+// If match is nil, the first packet matching the Transaction ID is returned.
+func (c *Client) SendAndReadEnvelope(ctx context.Context, dest *net.UDPAddr, msg *dhcpv6.Message, match EnvelopeMatcher) (*Envelope, error) {
+	var response *Envelope
+	start := time.Now()
+	attempt := 0
 	err := c.retryFn(func(timeout time.Duration) error {
-		ch, rem, err := c.send(dest, msg)
+		attempt++
+		sent := time.Now()
+		ch, rem, err := c.send(dest, msg, false)
 		if err != nil {
 			return err
 		}
+		c.slogSend(msg, dest, attempt)
+		if attempt > 1 {
+			c.metrics.add(&c.metrics.stats.Retransmissions)
+		}
 		c.logger.PrintMessage("sent message", msg)
 		defer rem()
 
 		for {
 			select {
 			case <-c.done:
-				return ErrNoResponse
+				return c.Err()
 
 			case <-time.After(timeout):
 				return errDeadlineExceeded
@@ -475,16 +787,21 @@ func (c *Client) SendAndRead(ctx context.Context, dest *net.UDPAddr, msg *dhcpv6
 			case <-ctx.Done():
 				return ctx.Err()
 
-			case packet := <-ch:
-				if match == nil || match(packet) {
-					c.logger.PrintMessage("received message", packet)
-					response = packet
+			case e := <-ch:
+				e.Sent = sent
+				if match == nil || match(e) {
+					c.logger.PrintMessage("received message", e.Message)
+					c.slogReceive(e)
+					c.metrics.observeRTT(msg.MessageType, e.RTT())
+					response = e
 					return nil
 				}
 			}
 		}
 	})
 	if err == errDeadlineExceeded {
+		c.slogTimeout(msg, dest, attempt, time.Since(start))
+		c.metrics.add(&c.metrics.stats.Timeouts)
 		return nil, ErrNoResponse
 	}
 	if err != nil {
@@ -493,6 +810,54 @@ func (c *Client) SendAndRead(ctx context.Context, dest *net.UDPAddr, msg *dhcpv6
 	return response, nil
 }
 
+// SendAndCollect sends a packet p to a destination dest and calls fn for
+// every response matching `match` as well as its Transaction ID, until the
+// timeout configured with WithTimeout elapses.
+//
+// Unlike SendAndRead it does not stop at the first response and does not
+// retransmit. If match is nil, all the packets matching the Transaction ID
+// are passed to fn.
+func (c *Client) SendAndCollect(ctx context.Context, dest *net.UDPAddr, msg *dhcpv6.Message, match EnvelopeMatcher, fn func(e *Envelope)) error {
+	return c.collect(ctx, dest, msg, match, fn, false)
+}
+
+// collect is SendAndCollect, passing the invalid responses to fn too if
+// keepInvalid is true.
+func (c *Client) collect(ctx context.Context, dest *net.UDPAddr, msg *dhcpv6.Message, match EnvelopeMatcher, fn func(e *Envelope), keepInvalid bool) error {
+	sent := time.Now()
+	ch, rem, err := c.send(dest, msg, keepInvalid)
+	if err != nil {
+		return err
+	}
+	c.slogSend(msg, dest, 1)
+	c.logger.PrintMessage("sent message", msg)
+	defer rem()
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-c.done:
+			return c.Err()
+
+		case <-timer.C:
+			return nil
+
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case e := <-ch:
+			e.Sent = sent
+			if match == nil || match(e) {
+				c.logger.PrintMessage("received message", e.Message)
+				c.slogReceive(e)
+				c.metrics.observeRTT(msg.MessageType, e.RTT())
+				fn(e)
+			}
+		}
+	}
+}
+
 func (c *Client) retryFn(fn func(timeout time.Duration) error) error {
 	timeout := c.timeout
 
@@ -517,7 +882,7 @@ func (c *Client) retryFn(fn func(timeout time.Duration) error) error {
 
 // logging - todo: review
 func (c *Client) Printf(format string, v ...any) {
-	c.logger.Printf(format, v)
+	c.logger.Printf(format, v...)
 }
 func (c *Client) PrintMessage(prefix string, message *dhcpv6.Message) {
 	c.logger.PrintMessage(prefix, message)
@@ -0,0 +1,155 @@
+package dhcp6c
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+// ParseHex decodes an hex string. Bytes may be separated by ':', '-', '.'
+// or spaces, an optional "0x" prefix is allowed.
+func ParseHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '-', '.', ' ', '\t':
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nil, errors.New("empty hex string")
+	}
+	return hex.DecodeString(s)
+}
+
+// ParseDUID parses a full DUID given in hex: the 2-octet type code followed
+// by the identifier. Unknown types are returned as *dhcpv6.DUIDOpaque and
+// the hardware type of DUID-LL/DUID-LLT is kept as is.
+func ParseDUID(s string) (dhcpv6.DUID, error) {
+	b, err := ParseHex(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad DUID: %w", err)
+	}
+	duid, err := dhcpv6.DUIDFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("bad DUID: %w", err)
+	}
+	return duid, nil
+}
+
+// WithRawClientID sets the Client Identifier option to the provided bytes.
+// The content is sent verbatim, without any check, so it can be used to
+// send malformed identifiers.
+func WithRawClientID(b []byte) dhcpv6.Modifier {
+	return func(d dhcpv6.DHCPv6) {
+		if m, ok := d.(*dhcpv6.Message); ok {
+			m.UpdateOption(&dhcpv6.OptionGeneric{
+				OptionCode: dhcpv6.OptionClientID,
+				OptionData: append([]byte(nil), b...),
+			})
+		}
+	}
+}
+
+// FormatDUID returns the DUID as colon separated hex bytes, the format used
+// by the DUID state file (and dhcpcd).
+func FormatDUID(duid dhcpv6.DUID) string {
+	b := duid.ToBytes()
+	s := make([]string, len(b))
+	for i, v := range b {
+		s[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(s, ":")
+}
+
+// GenerateDUID returns a new DUID-LLT built from hwaddr and the current time.
+// If hwaddr is empty (tunnels, ppp, ...) a random DUID-UUID is returned instead.
+func GenerateDUID(hwaddr net.HardwareAddr) dhcpv6.DUID {
+	if len(hwaddr) == 0 {
+		return &dhcpv6.DUIDUUID{UUID: uuid.New()}
+	}
+	return &dhcpv6.DUIDLLT{
+		HWType:        iana.HWTypeEthernet,
+		Time:          dhcpv6.GetTime(),
+		LinkLayerAddr: hwaddr,
+	}
+}
+
+// DefaultDUIDFile returns the default location of the DUID state file:
+// $XDG_STATE_HOME/testdhcpv6pd/duid, or ~/.local/state/testdhcpv6pd/duid
+// if XDG_STATE_HOME is not set.
+func DefaultDUIDFile() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "testdhcpv6pd", "duid"), nil
+}
+
+// LoadDUID reads a DUID from a state file.
+func LoadDUID(path string) (dhcpv6.DUID, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	duid, err := ParseDUID(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return duid, nil
+}
+
+// SaveDUID writes duid to a state file, creating the parent directories
+// if needed. The file is replaced atomically.
+func SaveDUID(path string, duid dhcpv6.DUID) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".duid-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintln(tmp, FormatDUID(duid)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadOrCreateDUID returns the DUID stored in path. If there is no such file,
+// or if rotate is true, a new DUID is obtained from gen and saved to path.
+// The returned bool is true when a new DUID was created.
+func LoadOrCreateDUID(path string, rotate bool, gen func() dhcpv6.DUID) (dhcpv6.DUID, bool, error) {
+	if !rotate {
+		duid, err := LoadDUID(path)
+		if err == nil {
+			return duid, false, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+	duid := gen()
+	if err := SaveDUID(path, duid); err != nil {
+		return nil, false, err
+	}
+	return duid, true, nil
+}
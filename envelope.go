@@ -0,0 +1,142 @@
+package dhcp6c
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// Envelope is a DHCPv6 message received by the client, with where and when
+// it was received.
+type Envelope struct {
+	Message *dhcpv6.Message
+	// Source is the address and port of the sender, with the zone for a
+	// link-local address. In relay mode it is the server, not the relay.
+	Source netip.AddrPort
+	// Interface is the name of the receiving interface, "" if unknown.
+	Interface string
+	// Received is the kernel receive timestamp on Linux UDP sockets, and
+	// the time the message was read otherwise.
+	Received time.Time
+	// Sent is the time of the last transmission of the request, it is only
+	// set by SendAndReadEnvelope and SendAndCollect.
+	Sent time.Time
+	// Invalid is why the message fails the RFC 8415 checks (see
+	// WithoutValidation), only for the exchanges which don't drop these
+	// messages: Audit.
+	Invalid error
+
+	// read is when the client got the message, with the monotonic clock
+	// reading of Sent: the kernel timestamps have none.
+	read time.Time
+}
+
+// RTT returns the time between the last transmission of the request and the
+// reception of the message, 0 if unknown. For the envelopes of the client it
+// is measured with the monotonic clock when the message is read, so a step
+// of the system clock doesn't change it.
+func (e *Envelope) RTT() time.Duration {
+	if e.Sent.IsZero() {
+		return 0
+	}
+	if !e.read.IsZero() {
+		return e.read.Sub(e.Sent)
+	}
+	return e.Received.Sub(e.Sent)
+}
+
+// EnvelopeMatcher matches received DHCP packets and their envelope.
+type EnvelopeMatcher func(*Envelope) bool
+
+// MatchMessage returns an envelope matcher checking the message with m, a
+// nil m matches all messages.
+func MatchMessage(m Matcher) EnvelopeMatcher {
+	return func(e *Envelope) bool {
+		return m == nil || m(e.Message)
+	}
+}
+
+// FromSource returns a matcher that checks the source address, ignoring the
+// zone.
+func FromSource(addr netip.Addr) EnvelopeMatcher {
+	addr = addr.WithZone("")
+	return func(e *Envelope) bool {
+		return e.Source.Addr().WithZone("") == addr
+	}
+}
+
+// OnInterface returns a matcher that checks the receiving interface.
+func OnInterface(name string) EnvelopeMatcher {
+	return func(e *Envelope) bool {
+		return e.Interface == name
+	}
+}
+
+// MatchAll returns a matcher that checks all the matchers are true.
+func MatchAll(mm ...EnvelopeMatcher) EnvelopeMatcher {
+	return func(e *Envelope) bool {
+		for _, m := range mm {
+			if !m(e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// read reads a datagram from the connection, with the receiving interface
+// index and the kernel timestamp when the connection reports them.
+func (c *Client) read(b []byte) (int, net.Addr, int, time.Time, error) {
+	if uc, ok := c.conn.(*net.UDPConn); ok && c.rxMeta {
+		n, oobn, _, peer, err := uc.ReadMsgUDP(b, c.oob)
+		if err != nil {
+			return 0, nil, 0, time.Time{}, err
+		}
+		ifindex, ts := parseRxMeta(c.oob[:oobn])
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		return n, peer, ifindex, ts, nil
+	}
+	n, peer, err := c.conn.ReadFrom(b)
+	return n, peer, 0, time.Now(), err
+}
+
+// newEnvelope returns the envelope of msg, received from peer on the
+// interface ifname.
+func (c *Client) newEnvelope(msg *dhcpv6.Message, peer net.Addr, ifname string, ts time.Time) *Envelope {
+	e := &Envelope{Message: msg, Received: ts, Interface: ifname, read: time.Now()}
+	if u, ok := peer.(*net.UDPAddr); ok {
+		e.Source = unmap(u.AddrPort())
+	}
+	return e
+}
+
+// interfaceName returns the name of the interface a datagram from peer was
+// received on, "" if unknown. The names of the indexes are cached: the
+// unbound sockets receive on any interface, but looking up an index is a
+// dump of all the links.
+func (c *Client) interfaceName(peer net.Addr, ifindex int) string {
+	if ifindex > 0 {
+		if name, ok := c.ifnames[ifindex]; ok {
+			return name
+		}
+		if i, err := net.InterfaceByIndex(ifindex); err == nil {
+			if c.ifnames == nil {
+				c.ifnames = make(map[int]string)
+			}
+			c.ifnames[ifindex] = i.Name
+			return i.Name
+		}
+	}
+	if u, ok := peer.(*net.UDPAddr); ok && u.Zone != "" {
+		return u.Zone
+	}
+	// bound to an interface: the raw connections, New
+	if u, ok := c.conn.LocalAddr().(*net.UDPAddr); ok {
+		return u.Zone
+	}
+	return ""
+}
@@ -5,6 +5,8 @@ go 1.24.0
 require (
 	github.com/google/uuid v1.6.0
 	github.com/insomniacslk/dhcp v0.0.0-20250109001534-8abf58130905
+	golang.org/x/net v0.33.0
+	golang.org/x/sys v0.30.0
 	nspeed.app/nspeed v0.12.0
 )
 
@@ -13,6 +15,4 @@ require (
 	github.com/libp2p/go-netroute v0.2.2 // indirect
 	github.com/pierrec/lz4/v4 v4.1.22 // indirect
 	github.com/u-root/uio v0.0.0-20240224005618-d2acac8f3701 // indirect
-	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 )
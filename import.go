@@ -0,0 +1,462 @@
+package dhcp6c
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// ClientIdentity is the identity of a DHCPv6 client, as found in the files of
+// another DHCPv6 client implementation.
+type ClientIdentity struct {
+	DUID dhcpv6.DUID
+	// IAIDs of the IA_PD options, if the client records them.
+	IAIDs [][4]byte
+}
+
+// Import formats accepted by ImportClientIdentity.
+const (
+	ImportDhcpcd   = "dhcpcd"   // dhcpcd duid file
+	ImportOdhcp6c  = "odhcp6c"  // OpenWrt /etc/config/network (odhcp6c)
+	ImportNetworkd = "networkd" // systemd-networkd link state file
+	ImportDhclient = "dhclient" // ISC dhclient -6 lease file
+	ImportWide     = "wide"     // wide-dhcpv6 dhcp6c_duid file
+)
+
+// importDefaultPaths lists, for each format, the usual locations of the
+// files, the first existing one is used. %s is replaced by the interface name
+// and %d by the interface index.
+var importDefaultPaths = map[string][]string{
+	ImportDhcpcd:   {"/var/lib/dhcpcd/duid", "/var/db/dhcpcd/duid", "/etc/dhcpcd.duid", "/var/db/dhcpcd.duid"},
+	ImportOdhcp6c:  {"/etc/config/network"},
+	ImportNetworkd: {"/run/systemd/netif/links/%d"},
+	ImportDhclient: {"/var/lib/dhcp/dhclient6.%s.leases", "/var/lib/dhcp/dhclient6.leases", "/var/lib/dhclient/dhclient6.%s.leases", "/var/lib/dhclient/dhclient6.leases"},
+	ImportWide:     {"/var/lib/dhcpv6/dhcp6c_duid", "/var/db/dhcp6c_duid"},
+}
+
+// ImportClientIdentity reads the DUID, and the IAIDs when available, used by
+// another DHCPv6 client on interface iface. format is one of the Import*
+// constants. If path is empty, the usual locations for this format are tried.
+func ImportClientIdentity(format, path, iface string) (*ClientIdentity, error) {
+	if path == "" {
+		var err error
+		if path, err = importFindPath(format, iface); err != nil {
+			return nil, err
+		}
+	}
+	var id *ClientIdentity
+	var err error
+	switch format {
+	case ImportDhcpcd:
+		id, err = importDhcpcd(path)
+	case ImportOdhcp6c:
+		id, err = importOdhcp6c(path, iface)
+	case ImportNetworkd:
+		id, err = importNetworkd(path)
+	case ImportDhclient:
+		id, err = importDhclient(path, iface)
+	case ImportWide:
+		id, err = importWide(path)
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return id, nil
+}
+
+func importFindPath(format, iface string) (string, error) {
+	paths, ok := importDefaultPaths[format]
+	if !ok {
+		return "", fmt.Errorf("unknown import format %q", format)
+	}
+	index := 0
+	if i, err := net.InterfaceByName(iface); err == nil {
+		index = i.Index
+	}
+	for _, p := range paths {
+		switch {
+		case strings.Contains(p, "%s"):
+			p = fmt.Sprintf(p, iface)
+		case strings.Contains(p, "%d"):
+			p = fmt.Sprintf(p, index)
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no %s file found, tried %s", format, strings.Join(paths, ", "))
+}
+
+// rawDUID parses a DUID read from another client. Malformed DUIDs of a known
+// type are kept as opaque so they are sent back exactly as read.
+func rawDUID(b []byte) (dhcpv6.DUID, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("DUID too short (%d bytes)", len(b))
+	}
+	duid, err := dhcpv6.DUIDFromBytes(b)
+	if err != nil {
+		return &dhcpv6.DUIDOpaque{
+			Type: dhcpv6.DUIDType(binary.BigEndian.Uint16(b)),
+			Data: append([]byte(nil), b[2:]...),
+		}, nil
+	}
+	return duid, nil
+}
+
+// parseColonHex parses colon separated hex bytes where leading zeros may be
+// omitted, as written by dhclient ("0:1:0:1:2b:...").
+func parseColonHex(s string) ([]byte, error) {
+	var b []byte
+	for _, f := range strings.Split(s, ":") {
+		v, err := strconv.ParseUint(f, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad hex byte %q", f)
+		}
+		b = append(b, byte(v))
+	}
+	return b, nil
+}
+
+// importDhcpcd reads a dhcpcd duid file: one line of colon separated hex.
+func importDhcpcd(path string) (*ClientIdentity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseHex(string(data))
+	if err != nil {
+		return nil, err
+	}
+	duid, err := rawDUID(b)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIdentity{DUID: duid}, nil
+}
+
+// importOdhcp6c reads an OpenWrt network config. The DUID is the clientid
+// option of the dhcpv6 interface using device iface (or the first dhcpv6
+// interface), or the global dhcp_default_duid option.
+func importOdhcp6c(path, iface string) (*ClientIdentity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type section struct {
+		typ     string
+		options map[string]string
+	}
+	var sections []*section
+	var cur *section
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "config":
+			cur = &section{typ: fields[1], options: map[string]string{}}
+			sections = append(sections, cur)
+		case "option":
+			if cur != nil && len(fields) >= 3 {
+				cur.options[fields[1]] = strings.Trim(strings.Join(fields[2:], " "), `'"`)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var clientID, defaultDUID string
+	var first, matched *section
+	for _, s := range sections {
+		switch {
+		case s.typ == "globals":
+			defaultDUID = s.options["dhcp_default_duid"]
+		case s.typ == "interface" && s.options["proto"] == "dhcpv6":
+			if first == nil {
+				first = s
+			}
+			if matched == nil && (s.options["device"] == iface || s.options["ifname"] == iface) {
+				matched = s
+			}
+		}
+	}
+	if matched == nil {
+		matched = first
+	}
+	if matched != nil {
+		clientID = matched.options["clientid"]
+	}
+	if clientID == "" {
+		clientID = defaultDUID
+	}
+	if clientID == "" {
+		return nil, errors.New("no clientid or dhcp_default_duid, odhcp6c uses a DUID-LL of the interface MAC address (see -dll)")
+	}
+	b, err := ParseHex(clientID)
+	if err != nil {
+		return nil, err
+	}
+	duid, err := rawDUID(b)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIdentity{DUID: duid}, nil
+}
+
+// networkdDUIDTypes maps the type names used by systemd-networkd in
+// DHCP6_CLIENT_DUID to DUID types. systemd names the type 4 "UUID".
+var networkdDUIDTypes = map[string]dhcpv6.DUIDType{
+	"DUID-LLT":       dhcpv6.DUID_LLT,
+	"DUID-EN/Vendor": dhcpv6.DUID_EN,
+	"DUID-LL":        dhcpv6.DUID_LL,
+	"UUID":           dhcpv6.DUID_UUID,
+	"DUID-UUID":      dhcpv6.DUID_UUID,
+}
+
+// importNetworkd reads a systemd-networkd link state file
+// (DHCP6_CLIENT_DUID and DHCP6_CLIENT_IAID keys).
+func importNetworkd(path string) (*ClientIdentity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	id := &ClientIdentity{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "DHCP6_CLIENT_IAID":
+			v, err := strconv.ParseUint(value, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad IAID %q", value)
+			}
+			var iaid [4]byte
+			binary.BigEndian.PutUint32(iaid[:], uint32(v))
+			id.IAIDs = append(id.IAIDs, iaid)
+		case "DHCP6_CLIENT_DUID":
+			// "<type name>:<hex data>" for known types, hex of the whole DUID otherwise
+			var b []byte
+			name, data, _ := strings.Cut(value, ":")
+			if typ, known := networkdDUIDTypes[name]; known {
+				d, err := ParseHex(data)
+				if err != nil {
+					return nil, err
+				}
+				b = append(binary.BigEndian.AppendUint16(nil, uint16(typ)), d...)
+			} else if b, err = ParseHex(value); err != nil {
+				return nil, err
+			}
+			if id.DUID, err = rawDUID(b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if id.DUID == nil {
+		return nil, errors.New("no DHCP6_CLIENT_DUID found")
+	}
+	return id, nil
+}
+
+// unquoteDhclient decodes a dhclient quoted string, non printable bytes are
+// written as \ooo octal escapes.
+func unquoteDhclient(s string) ([]byte, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, `"`), `"`)
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+3 < len(s) && s[i+1] >= '0' && s[i+1] <= '3' {
+			v, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+			if err != nil {
+				return nil, fmt.Errorf("bad escape in %q", s)
+			}
+			b = append(b, byte(v))
+			i += 3
+			continue
+		}
+		if i+1 >= len(s) {
+			return nil, fmt.Errorf("bad escape in %q", s)
+		}
+		b = append(b, s[i+1])
+		i++
+	}
+	return b, nil
+}
+
+// dhclientBytes decodes a dhclient value, either a quoted string or colon
+// separated hex.
+func dhclientBytes(s string) ([]byte, error) {
+	if strings.HasPrefix(s, `"`) {
+		return unquoteDhclient(s)
+	}
+	return parseColonHex(s)
+}
+
+// dhclientTokens splits a line of a dhclient lease file into tokens: quoted
+// strings (with the quotes, they may contain spaces and escapes), braces,
+// semicolons and words.
+func dhclientTokens(line string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, line[i:i+1])
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, fmt.Errorf("unterminated string in %q", line)
+			}
+			tokens = append(tokens, line[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && !strings.ContainsRune(" \t{};\"", rune(line[j])) {
+				j++
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// importDhclient reads a dhclient -6 lease file. The client-id of the last
+// lease for iface wins over default-duid, the IAIDs come from the ia-pd of
+// this lease.
+func importDhclient(path, iface string) (*ClientIdentity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultDUID, clientID []byte
+	var iaids [][4]byte
+	var leaseIface string
+	var leaseClientID []byte
+	var leaseIAIDs [][4]byte
+	depth := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens, err := dhclientTokens(line)
+		if err != nil {
+			return nil, err
+		}
+		// the statement, without the punctuation
+		var fields []string
+		blockDepth := depth
+		for _, t := range tokens {
+			switch t {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			case ";":
+			default:
+				fields = append(fields, t)
+			}
+		}
+		switch {
+		case len(fields) == 0:
+		case blockDepth == 0 && fields[0] == "default-duid" && len(fields) >= 2:
+			if defaultDUID, err = unquoteDhclient(fields[1]); err != nil {
+				return nil, err
+			}
+		case blockDepth == 0 && fields[0] == "lease6":
+			leaseIface, leaseClientID, leaseIAIDs = "", nil, nil
+		case blockDepth == 1 && fields[0] == "interface" && len(fields) >= 2:
+			leaseIface = strings.Trim(fields[1], `"`)
+		case blockDepth == 1 && fields[0] == "ia-pd" && len(fields) >= 2:
+			b, err := dhclientBytes(fields[1])
+			if err != nil || len(b) != 4 {
+				return nil, fmt.Errorf("bad ia-pd IAID %s", fields[1])
+			}
+			leaseIAIDs = append(leaseIAIDs, [4]byte(b))
+		case blockDepth == 1 && len(fields) >= 3 && fields[0] == "option" && fields[1] == "dhcp6.client-id":
+			if leaseClientID, err = dhclientBytes(fields[2]); err != nil {
+				return nil, err
+			}
+		}
+		if blockDepth > 0 && depth == 0 && (iface == "" || leaseIface == "" || leaseIface == iface) {
+			// end of a lease6 block for our interface
+			if leaseClientID != nil {
+				clientID = leaseClientID
+			}
+			if leaseIAIDs != nil {
+				iaids = leaseIAIDs
+			}
+		}
+	}
+
+	if clientID == nil {
+		clientID = defaultDUID
+	}
+	if clientID == nil {
+		return nil, errors.New("no default-duid or dhcp6.client-id found")
+	}
+	duid, err := rawDUID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIdentity{DUID: duid, IAIDs: iaids}, nil
+}
+
+// importWide reads a wide-dhcpv6 dhcp6c_duid file: a 16-bit length in host
+// byte order followed by the DUID.
+func importWide(path string) (*ClientIdentity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, errors.New("file too short")
+	}
+	n := int(binary.LittleEndian.Uint16(data))
+	if n != len(data)-2 {
+		n = int(binary.BigEndian.Uint16(data))
+	}
+	if n != len(data)-2 {
+		return nil, fmt.Errorf("bad DUID length %d for %d bytes", n, len(data)-2)
+	}
+	duid, err := rawDUID(bytes.Clone(data[2:]))
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIdentity{DUID: duid}, nil
+}
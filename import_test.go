@@ -0,0 +1,80 @@
+package dhcp6c
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// The link state files of testdata/networkd have the DHCP6_CLIENT_DUID forms
+// written by systemd-networkd: "<type name>:<hex data>" for the types it
+// names, the hex of the whole DUID for the others.
+func TestImportNetworkd(t *testing.T) {
+	for _, tt := range []struct {
+		file string
+		typ  dhcpv6.DUIDType
+		duid string
+	}{
+		{"duid-llt", dhcpv6.DUID_LLT, "000100012a3b4c5d020000000001"},
+		{"duid-en", dhcpv6.DUID_EN, "00020000ab11f5c2a8b4e1d09a3c"},
+		{"duid-ll", dhcpv6.DUID_LL, "00030001020000000001"},
+		{"uuid", dhcpv6.DUID_UUID, "00044f1c6d2a9b3e4c7d8e5f0a1b2c3d4e5f"},
+		{"other", 5, "0005aabbccddeeff"},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			id, err := importNetworkd(filepath.Join("testdata", "networkd", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.DUID.DUIDType() != tt.typ {
+				t.Errorf("DUID type %s, want %s", id.DUID.DUIDType(), tt.typ)
+			}
+			want, _ := hex.DecodeString(tt.duid)
+			if got := id.DUID.ToBytes(); !bytes.Equal(got, want) {
+				t.Errorf("DUID %x, want %x", got, want)
+			}
+			if len(id.IAIDs) != 1 || id.IAIDs[0] != [4]byte{0x6e, 0x27, 0xa1, 0xb2} {
+				t.Errorf("IAIDs %x, want [6e27a1b2]", id.IAIDs)
+			}
+		})
+	}
+}
+
+func TestImportClientIdentity(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		format string
+		path   string
+		iface  string
+		duid   string
+		iaids  [][4]byte
+	}{
+		{"dhclient lease", ImportDhclient, "dhclient/dhclient6.leases", "eth0", "000100012a3b4c5d020000000001", [][4]byte{{0x6e, 0x27, 0xa1, 0xb2}}},
+		// spaces in the quoted client-id
+		{"dhclient quoted", ImportDhclient, "dhclient/dhclient6.leases", "eth1", "00030001202000000001", [][4]byte{{0, 0, 0, 1}}},
+		// spaces, ; and { in the quoted default-duid
+		{"dhclient default", ImportDhclient, "dhclient/dhclient6.leases", "eth2", "00020000ab11612020623b7b", nil},
+		{"dhcpcd", ImportDhcpcd, "dhcpcd/duid", "eth0", "000100012a3b4c5d020000000001", nil},
+		{"odhcp6c clientid", ImportOdhcp6c, "odhcp6c/network", "eth0", "000100012a3b4c5d020000000001", nil},
+		{"odhcp6c default", ImportOdhcp6c, "odhcp6c/network", "eth1", "00030001020000000002", nil},
+		{"wide", ImportWide, "wide/dhcp6c_duid", "eth0", "000100012a3b4c5d020000000001", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ImportClientIdentity(tt.format, filepath.Join("testdata", tt.path), tt.iface)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := hex.DecodeString(tt.duid)
+			if got := id.DUID.ToBytes(); !bytes.Equal(got, want) {
+				t.Errorf("DUID %x, want %x", got, want)
+			}
+			if !reflect.DeepEqual(id.IAIDs, tt.iaids) {
+				t.Errorf("IAIDs %x, want %x", id.IAIDs, tt.iaids)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package dhcp6c
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// WaitLinkLocal waits until iface is up and has a usable link-local address,
+// that is an address for which duplicate address detection is complete, and
+// returns it. It fails when ctx is done.
+func WaitLinkLocal(ctx context.Context, iface string) (net.IP, error) {
+	return waitLinkLocalAddr(ctx, iface, nil)
+}
+
+// waitLinkLocalAddr is WaitLinkLocal waiting for the address want, or for
+// any link-local address if want is nil.
+func waitLinkLocalAddr(ctx context.Context, iface string, want net.IP) (net.IP, error) {
+	ip, err := waitLinkLocal(ctx, iface, want)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("%s: no usable link-local address: %w", iface, ctx.Err())
+	}
+	return ip, err
+}
+
+// LinkLocalAddrs returns the link-local addresses of iface.
+func LinkLocalAddrs(iface string) ([]net.IP, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := i.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() == nil && n.IP.IsLinkLocalUnicast() {
+			ips = append(ips, n.IP)
+		}
+	}
+	return ips, nil
+}
+
+// checkLinkLocal returns an error if ip is not a link-local address of iface.
+func checkLinkLocal(iface string, ip net.IP) error {
+	ips, err := LinkLocalAddrs(iface)
+	if err != nil {
+		return err
+	}
+	for _, v := range ips {
+		if v.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a link-local address of %s (have %v)", ip, iface, ips)
+}
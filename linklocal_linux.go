@@ -0,0 +1,114 @@
+package dhcp6c
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// see linux/rtnetlink.h and linux/if_addr.h
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv6IfAddr = 0x100
+
+	// ifaFlags is the attribute with the 32 bit address flags
+	ifaFlags = 8
+)
+
+// waitLinkLocal subscribes to the link and IPv6 address netlink
+// notifications and checks the interface on each of them.
+func waitLinkLocal(ctx context.Context, iface string, want net.IP) (net.IP, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv6IfAddr,
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	file := os.NewFile(uintptr(fd), "netlink")
+	defer file.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		file.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	// subscribed before the first check, so no change can be missed
+	buf := make([]byte, 16384)
+	for {
+		ip, err := linkLocalReady(iface, want)
+		if ip != nil || err != nil {
+			return ip, err
+		}
+		if _, err := file.Read(buf); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// linkLocalReady returns the first usable link-local address of iface (or
+// want if not nil), or nil if the interface is down or the link-local
+// addresses are tentative.
+func linkLocalReady(iface string, want net.IP) (net.IP, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil || i.Flags&net.FlagUp == 0 {
+		// not created or not up yet
+		return nil, nil
+	}
+
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_INET6)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+	dadFailed := false
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR || len(m.Data) < syscall.SizeofIfAddrmsg {
+			continue
+		}
+		if int(binary.NativeEndian.Uint32(m.Data[4:])) != i.Index {
+			continue
+		}
+		flags := uint32(m.Data[2])
+		var ip net.IP
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range attrs {
+			switch a.Attr.Type {
+			case syscall.IFA_ADDRESS:
+				ip = net.IP(a.Value)
+			case ifaFlags:
+				if len(a.Value) == 4 {
+					flags = binary.NativeEndian.Uint32(a.Value)
+				}
+			}
+		}
+		if !ip.IsLinkLocalUnicast() || (want != nil && !want.Equal(ip)) {
+			continue
+		}
+		switch {
+		case flags&syscall.IFA_F_DADFAILED != 0:
+			dadFailed = true
+		case flags&syscall.IFA_F_TENTATIVE == 0:
+			return ip, nil
+		}
+	}
+	if dadFailed {
+		return nil, errors.New("duplicate address detection failed for the link-local address of " + iface)
+	}
+	return nil, nil
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package dhcp6c
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// waitLinkLocal polls the interface, the address state (tentative or not)
+// is not available here so the first link-local address (or want) is
+// returned once the interface is up.
+func waitLinkLocal(ctx context.Context, iface string, want net.IP) (net.IP, error) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if i, err := net.InterfaceByName(iface); err == nil && i.Flags&net.FlagUp != 0 {
+			if want != nil {
+				if checkLinkLocal(iface, want) == nil {
+					return want, nil
+				}
+			} else if ip, err := dhcpv6.GetLinkLocalAddr(iface); err == nil {
+				return ip, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package dhcp6c
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// RTTBuckets are the upper bounds of the RTT histogram buckets.
+var RTTBuckets = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Histogram is a distribution of durations.
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets, see RTTBuckets.
+	Bounds []time.Duration
+	// Counts are the cumulative counts: Counts[i] is the number of
+	// observations lower than or equal to Bounds[i].
+	Counts []uint64
+	// Count is the number of observations, Sum their total.
+	Count uint64
+	Sum   time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Bounds == nil {
+		h.Bounds = RTTBuckets
+		h.Counts = make([]uint64, len(RTTBuckets))
+	}
+	for i, b := range h.Bounds {
+		if d <= b {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += d
+}
+
+// Stats are the counters of a client since it was created.
+type Stats struct {
+	// Sent counts the messages sent by type, retransmissions included. In
+	// relay mode the type is the one of the relayed message.
+	Sent map[dhcpv6.MessageType]uint64
+	// Received counts the decoded messages by type, dropped ones included.
+	Received map[dhcpv6.MessageType]uint64
+	// Retransmissions counts the messages sent again after a timeout.
+	Retransmissions uint64
+	// Timeouts counts the exchanges which got no response, see
+	// ErrNoResponse.
+	Timeouts uint64
+	// Dropped counts the responses dropped because the queue of their
+	// transaction was full, see Dropped.
+	Dropped uint64
+	// Invalid counts the responses dropped because they fail the RFC 8415
+	// checks, see WithoutValidation.
+	Invalid uint64
+	// Malformed counts the datagrams which are not DHCPv6 messages or are
+	// too large.
+	Malformed uint64
+	// Unsolicited counts the messages with no pending transaction nor
+	// subscriber.
+	Unsolicited uint64
+	// RTT is the time between the last transmission of a request and its
+	// response, by request type.
+	RTT map[dhcpv6.MessageType]*Histogram
+}
+
+// metrics are the counters of Stats, dropped is counted by the client.
+type metrics struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func (m *metrics) count(counts *map[dhcpv6.MessageType]uint64, t dhcpv6.MessageType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if *counts == nil {
+		*counts = make(map[dhcpv6.MessageType]uint64)
+	}
+	(*counts)[t]++
+}
+
+func (m *metrics) add(counter *uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*counter++
+}
+
+func (m *metrics) observeRTT(t dhcpv6.MessageType, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stats.RTT == nil {
+		m.stats.RTT = make(map[dhcpv6.MessageType]*Histogram)
+	}
+	h := m.stats.RTT[t]
+	if h == nil {
+		h = &Histogram{}
+		m.stats.RTT[t] = h
+	}
+	h.observe(d)
+}
+
+// Stats returns a snapshot of the counters of the client.
+func (c *Client) Stats() *Stats {
+	c.metrics.mu.Lock()
+	defer c.metrics.mu.Unlock()
+	s := c.metrics.stats
+	s.Sent = make(map[dhcpv6.MessageType]uint64)
+	for t, n := range c.metrics.stats.Sent {
+		s.Sent[t] = n
+	}
+	s.Received = make(map[dhcpv6.MessageType]uint64)
+	for t, n := range c.metrics.stats.Received {
+		s.Received[t] = n
+	}
+	s.RTT = make(map[dhcpv6.MessageType]*Histogram)
+	for t, h := range c.metrics.stats.RTT {
+		cop := *h
+		cop.Counts = slices.Clone(h.Counts)
+		s.RTT[t] = &cop
+	}
+	s.Dropped = c.dropped.Load()
+	return &s
+}
+
+// sortedTypes returns the message types of m in numeric order, for a
+// stable output.
+func sortedTypes[V any](m map[dhcpv6.MessageType]V) []dhcpv6.MessageType {
+	types := make([]dhcpv6.MessageType, 0, len(m))
+	for t := range m {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// WritePrometheus writes the stats in the Prometheus text exposition format.
+// The metrics are prefixed with dhcpv6_client_.
+func (s *Stats) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	counters := func(name, help string, m map[dhcpv6.MessageType]uint64) {
+		fmt.Fprintf(bw, "# HELP dhcpv6_client_%s %s\n# TYPE dhcpv6_client_%s counter\n", name, help, name)
+		for _, t := range sortedTypes(m) {
+			fmt.Fprintf(bw, "dhcpv6_client_%s{type=%q} %d\n", name, t, m[t])
+		}
+	}
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(bw, "# HELP dhcpv6_client_%s %s\n# TYPE dhcpv6_client_%s counter\ndhcpv6_client_%s %d\n", name, help, name, name, v)
+	}
+
+	counters("messages_sent_total", "Messages sent by type, retransmissions included.", s.Sent)
+	counters("messages_received_total", "Messages received by type.", s.Received)
+	counter("retransmissions_total", "Messages sent again after a timeout.", s.Retransmissions)
+	counter("timeouts_total", "Exchanges without response.", s.Timeouts)
+	fmt.Fprint(bw, "# HELP dhcpv6_client_dropped_total Received packets dropped, by reason.\n# TYPE dhcpv6_client_dropped_total counter\n")
+	for _, d := range []struct {
+		reason string
+		v      uint64
+	}{
+		{"queue_full", s.Dropped},
+		{"invalid", s.Invalid},
+		{"malformed", s.Malformed},
+		{"unsolicited", s.Unsolicited},
+	} {
+		fmt.Fprintf(bw, "dhcpv6_client_dropped_total{reason=%q} %d\n", d.reason, d.v)
+	}
+
+	fmt.Fprint(bw, "# HELP dhcpv6_client_rtt_seconds Time between the last transmission of a request and its response, by request type.\n# TYPE dhcpv6_client_rtt_seconds histogram\n")
+	for _, t := range sortedTypes(s.RTT) {
+		h := s.RTT[t]
+		for i, b := range h.Bounds {
+			fmt.Fprintf(bw, "dhcpv6_client_rtt_seconds_bucket{type=%q,le=\"%g\"} %d\n", t, b.Seconds(), h.Counts[i])
+		}
+		fmt.Fprintf(bw, "dhcpv6_client_rtt_seconds_bucket{type=%q,le=\"+Inf\"} %d\n", t, h.Count)
+		fmt.Fprintf(bw, "dhcpv6_client_rtt_seconds_sum{type=%q} %g\n", t, h.Sum.Seconds())
+		fmt.Fprintf(bw, "dhcpv6_client_rtt_seconds_count{type=%q} %d\n", t, h.Count)
+	}
+	return bw.Flush()
+}
+
+// MetricsHandler returns an HTTP handler serving the stats of the client in
+// the Prometheus text exposition format.
+func (c *Client) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Stats().WritePrometheus(w)
+	})
+}
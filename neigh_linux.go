@@ -0,0 +1,60 @@
+package dhcp6c
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+// neighbor attributes, see linux/neighbour.h
+const (
+	ndaDst    = 1
+	ndaLLAddr = 2
+
+	sizeofNdMsg = 12
+)
+
+// neighbors returns the IPv6 neighbor table, MAC addresses indexed by IP.
+func neighbors() (map[string]net.HardwareAddr, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_INET6)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	neigh := make(map[string]net.HardwareAddr)
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < sizeofNdMsg {
+			continue
+		}
+		var ip net.IP
+		var hw net.HardwareAddr
+		b := m.Data[sizeofNdMsg:]
+		for len(b) >= syscall.SizeofRtAttr {
+			l := int(binary.NativeEndian.Uint16(b))
+			typ := binary.NativeEndian.Uint16(b[2:])
+			if l < syscall.SizeofRtAttr || l > len(b) {
+				break
+			}
+			data := b[syscall.SizeofRtAttr:l]
+			switch typ {
+			case ndaDst:
+				ip = net.IP(append([]byte(nil), data...))
+			case ndaLLAddr:
+				hw = net.HardwareAddr(append([]byte(nil), data...))
+			}
+			l = (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+			if l > len(b) {
+				break
+			}
+			b = b[l:]
+		}
+		if ip != nil && len(hw) > 0 {
+			neigh[ip.String()] = hw
+		}
+	}
+	return neigh, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package dhcp6c
+
+import (
+	"errors"
+	"net"
+)
+
+// neighbors returns the IPv6 neighbor table, MAC addresses indexed by IP.
+func neighbors() (map[string]net.HardwareAddr, error) {
+	return nil, errors.New("not implemented on this platform")
+}
@@ -0,0 +1,158 @@
+package dhcp6c
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// pcapng block types and options, see
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+const (
+	pcapngSectionHeader  = 0x0a0d0d0a
+	pcapngInterfaceDesc  = 0x00000001
+	pcapngEnhancedPacket = 0x00000006
+	pcapngByteOrderMagic = 0x1a2b3c4d
+	pcapngLinkTypeRaw    = 101 // raw IP, the version is in the header
+	pcapngLinkTypeEther  = 1
+	pcapngOptEnd         = 0
+	pcapngOptUserAppl    = 4
+	pcapngOptIfName      = 2
+	pcapngOptIfTsresol   = 9
+	pcapngOptEPBFlags    = 2
+	pcapngFlagInbound    = 1
+	pcapngFlagOutbound   = 2
+)
+
+// PcapngWriter writes packets to a pcapng file, with synthesized IPv6 and
+// UDP headers. It can be used by several goroutines, see WithCapture.
+type PcapngWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// ifaces are the interface IDs by name and link type, an Interface
+	// Description Block is written for each new one.
+	ifaces map[pcapngIfaceKey]uint32
+}
+
+type pcapngIfaceKey struct {
+	name     string
+	linkType uint16
+}
+
+// NewPcapngWriter writes the section header to w and returns the writer.
+// appl is the name of the application, written in the header.
+func NewPcapngWriter(w io.Writer, appl string) (*PcapngWriter, error) {
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, pcapngByteOrderMagic)
+	body = binary.LittleEndian.AppendUint16(body, 1) // version 1.0
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint64(body, ^uint64(0)) // unknown section length
+	if appl != "" {
+		body = pcapngOption(body, pcapngOptUserAppl, []byte(appl))
+		body = pcapngOption(body, pcapngOptEnd, nil)
+	}
+	if _, err := w.Write(pcapngBlock(pcapngSectionHeader, body)); err != nil {
+		return nil, err
+	}
+	return &PcapngWriter{w: w, ifaces: make(map[pcapngIfaceKey]uint32)}, nil
+}
+
+// WritePacket writes p with its IPv6 and UDP headers.
+func (pw *PcapngWriter) WritePacket(p *Packet) error {
+	return pw.write(p, pcapngLinkTypeRaw, ipv6UDPPacket(p))
+}
+
+// WriteFrame writes the Ethernet frame of p, see RawConfig.Frame.
+func (pw *PcapngWriter) WriteFrame(p *Packet, frame []byte) error {
+	return pw.write(p, pcapngLinkTypeEther, frame)
+}
+
+// write writes data, a packet of the link type, with the time, direction and
+// interface of p.
+func (pw *PcapngWriter) write(p *Packet, linkType uint16, data []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	key := pcapngIfaceKey{p.Interface, linkType}
+	id, ok := pw.ifaces[key]
+	if !ok {
+		var body []byte
+		body = binary.LittleEndian.AppendUint16(body, linkType)
+		body = binary.LittleEndian.AppendUint16(body, 0)
+		body = binary.LittleEndian.AppendUint32(body, 0) // no snap length
+		if p.Interface != "" {
+			body = pcapngOption(body, pcapngOptIfName, []byte(p.Interface))
+		}
+		body = pcapngOption(body, pcapngOptIfTsresol, []byte{9}) // nanoseconds
+		body = pcapngOption(body, pcapngOptEnd, nil)
+		if _, err := pw.w.Write(pcapngBlock(pcapngInterfaceDesc, body)); err != nil {
+			return err
+		}
+		id = uint32(len(pw.ifaces))
+		pw.ifaces[key] = id
+	}
+
+	ts := uint64(p.Time.UnixNano())
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, id)
+	body = binary.LittleEndian.AppendUint32(body, uint32(ts>>32))
+	body = binary.LittleEndian.AppendUint32(body, uint32(ts))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = append(body, data...)
+	body = append(body, make([]byte, pad4(len(data)))...)
+	flags := uint32(pcapngFlagInbound)
+	if p.Sent {
+		flags = pcapngFlagOutbound
+	}
+	body = pcapngOption(body, pcapngOptEPBFlags, binary.LittleEndian.AppendUint32(nil, flags))
+	body = pcapngOption(body, pcapngOptEnd, nil)
+	_, err := pw.w.Write(pcapngBlock(pcapngEnhancedPacket, body))
+	return err
+}
+
+// ipv6UDPPacket returns the payload of p with IPv6 and UDP headers.
+func ipv6UDPPacket(p *Packet) []byte {
+	// unknown addresses are ::
+	src, dst := p.Source.Addr().As16(), p.Dest.Addr().As16()
+	hopLimit := byte(64)
+	if p.Dest.Addr().IsMulticast() {
+		hopLimit = 1
+	}
+	udpLen := udpHeaderLen + len(p.Payload)
+	b := make([]byte, 0, ipv6HeaderLen+udpLen)
+	b = append(b, 0x60, 0, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+	b = append(b, protoUDP, hopLimit)
+	b = append(b, src[:]...)
+	b = append(b, dst[:]...)
+
+	b = binary.BigEndian.AppendUint16(b, p.Source.Port())
+	b = binary.BigEndian.AppendUint16(b, p.Dest.Port())
+	b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+	b = append(b, 0, 0)
+	b = append(b, p.Payload...)
+	binary.BigEndian.PutUint16(b[ipv6HeaderLen+6:], udpChecksum(src[:], dst[:], b[ipv6HeaderLen:]))
+	return b
+}
+
+// pcapngOption appends an option to b, padded to 32 bits.
+func pcapngOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pad4(len(value)))...)
+}
+
+// pcapngBlock returns a block with its type and lengths.
+func pcapngBlock(typ uint32, body []byte) []byte {
+	n := uint32(12 + len(body))
+	b := binary.LittleEndian.AppendUint32(nil, typ)
+	b = binary.LittleEndian.AppendUint32(b, n)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, n)
+}
+
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
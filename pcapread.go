@@ -0,0 +1,281 @@
+package dhcp6c
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// link types of the captures, see https://www.tcpdump.org/linktypes.html
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeSLL      = 113
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// pcap magic numbers, as read in little endian
+const (
+	pcapMagicMicro        = 0xa1b2c3d4
+	pcapMagicNano         = 0xa1b23c4d
+	pcapMagicMicroSwapped = 0xd4c3b2a1
+	pcapMagicNanoSwapped  = 0x4d3cb2a1
+)
+
+// pcapng blocks only used by the reader
+const (
+	pcapngSimplePacket = 0x00000003
+	pcapngPacket       = 0x00000002 // obsolete
+)
+
+var errBadCapture = errors.New("not a pcap or pcapng capture")
+
+// IsCapture returns whether b starts like a pcap or pcapng capture.
+func IsCapture(b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case pcapngSectionHeader, pcapMagicMicro, pcapMagicNano, pcapMagicMicroSwapped, pcapMagicNanoSwapped:
+		return true
+	}
+	return false
+}
+
+// ReadCapture reads a pcap or pcapng capture and calls fn with the DHCPv6
+// datagrams it contains (UDP port 546 or 547), n is the number of the frame
+// in the capture, from 1 as Wireshark numbers them. The other frames are
+// skipped. Sent is true for the datagrams to port 547, to a server or a
+// relay.
+//
+// The supported link types are Ethernet (with 802.1Q and 802.1ad tags), raw
+// IP, Linux cooked captures (SLL and SLL2) and BSD loopback.
+func ReadCapture(r io.Reader, fn func(n int, p *Packet)) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(b) < 4 {
+		return errBadCapture
+	}
+	if binary.LittleEndian.Uint32(b) == pcapngSectionHeader {
+		return readPcapng(b, fn)
+	}
+	return readPcap(b, fn)
+}
+
+// capturedPacket calls fn if frame is a DHCPv6 datagram.
+func capturedPacket(n int, linkType int, frame []byte, ts time.Time, iface string, fn func(n int, p *Packet)) {
+	b := linkPayload(linkType, frame)
+	if b == nil {
+		return
+	}
+	payload, src, dst, err := parseIPv6UDP(b)
+	if err != nil && err != errTruncated {
+		return
+	}
+	if !isDHCPv6Port(src.Port()) && !isDHCPv6Port(dst.Port()) {
+		return
+	}
+	fn(n, &Packet{
+		Time:      ts,
+		Sent:      dst.Port() == dhcpv6.DefaultServerPort,
+		Source:    src,
+		Dest:      dst,
+		Interface: iface,
+		Payload:   payload,
+		Truncated: err == errTruncated,
+	})
+}
+
+func isDHCPv6Port(port uint16) bool {
+	return port == dhcpv6.DefaultClientPort || port == dhcpv6.DefaultServerPort
+}
+
+// linkPayload returns the IPv6 packet of a frame, nil if it isn't one.
+func linkPayload(linkType int, frame []byte) []byte {
+	switch linkType {
+	case linkTypeEthernet:
+		if etherType, b := ethernetPayload(frame); etherType == etherTypeIPv6 {
+			return b
+		}
+	case linkTypeRaw, linkTypeIPv6:
+		return frame
+	case linkTypeSLL:
+		if len(frame) >= 16 && binary.BigEndian.Uint16(frame[14:]) == etherTypeIPv6 {
+			return frame[16:]
+		}
+	case linkTypeSLL2:
+		if len(frame) >= 20 && binary.BigEndian.Uint16(frame) == etherTypeIPv6 {
+			return frame[20:]
+		}
+	case linkTypeNull, linkTypeLoop:
+		// the address family, AF_INET6 varies between systems
+		if len(frame) >= 4 {
+			family := binary.LittleEndian.Uint32(frame)
+			if linkType == linkTypeLoop || family > 0xffff {
+				family = binary.BigEndian.Uint32(frame)
+			}
+			if family == 10 || family == 24 || family == 28 || family == 30 {
+				return frame[4:]
+			}
+		}
+	}
+	return nil
+}
+
+func readPcap(b []byte, fn func(n int, p *Packet)) error {
+	if len(b) < 24 {
+		return errBadCapture
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	nano := false
+	switch binary.LittleEndian.Uint32(b) {
+	case pcapMagicMicro:
+	case pcapMagicNano:
+		nano = true
+	case pcapMagicMicroSwapped:
+		order = binary.BigEndian
+	case pcapMagicNanoSwapped:
+		order, nano = binary.BigEndian, true
+	default:
+		return errBadCapture
+	}
+	linkType := int(order.Uint32(b[20:]) & 0xffff)
+	b = b[24:]
+	for n := 1; len(b) > 0; n++ {
+		if len(b) < 16 {
+			return fmt.Errorf("frame %d: truncated record header", n)
+		}
+		sec, frac, capLen := order.Uint32(b), order.Uint32(b[4:]), order.Uint32(b[8:])
+		// compared before the conversion, an int can be 32 bits
+		if uint64(capLen) > uint64(len(b)-16) {
+			return fmt.Errorf("frame %d: truncated record", n)
+		}
+		if !nano {
+			frac *= 1000
+		}
+		capturedPacket(n, linkType, b[16:16+int(capLen)], time.Unix(int64(sec), int64(frac)), "", fn)
+		b = b[16+int(capLen):]
+	}
+	return nil
+}
+
+// pcapngIface is an interface of a pcapng section.
+type pcapngIface struct {
+	linkType int
+	name     string
+	tsresol  byte
+}
+
+func readPcapng(b []byte, fn func(n int, p *Packet)) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var ifaces []pcapngIface
+	for n := 1; len(b) > 0; {
+		if len(b) < 12 {
+			return errors.New("truncated pcapng block")
+		}
+		typ := order.Uint32(b)
+		if typ == pcapngSectionHeader {
+			// a new section, possibly with another byte order
+			if binary.LittleEndian.Uint32(b[8:]) == pcapngByteOrderMagic {
+				order = binary.LittleEndian
+			} else {
+				order = binary.BigEndian
+			}
+			ifaces = nil
+		}
+		bl := order.Uint32(b[4:])
+		if bl < 12 || uint64(bl) > uint64(len(b)) {
+			return fmt.Errorf("bad pcapng block length %d", bl)
+		}
+		l := int(bl)
+		body := b[8 : l-4]
+		b = b[l:]
+
+		switch typ {
+		case pcapngInterfaceDesc:
+			if len(body) < 8 {
+				return errors.New("truncated interface description block")
+			}
+			iface := pcapngIface{linkType: int(order.Uint16(body)), tsresol: 6}
+			pcapngOptions(order, body[8:], func(code uint16, v []byte) {
+				switch {
+				case code == pcapngOptIfName:
+					iface.name = string(v)
+				case code == pcapngOptIfTsresol && len(v) == 1:
+					iface.tsresol = v[0]
+				}
+			})
+			ifaces = append(ifaces, iface)
+
+		case pcapngEnhancedPacket, pcapngPacket:
+			// same layout, the obsolete block has a 16 bits interface ID
+			if len(body) < 20 {
+				return fmt.Errorf("frame %d: truncated packet block", n)
+			}
+			id := order.Uint32(body)
+			if typ == pcapngPacket {
+				id = uint32(order.Uint16(body))
+			}
+			capLen := order.Uint32(body[12:])
+			if uint64(id) >= uint64(len(ifaces)) || uint64(capLen) > uint64(len(body)-20) {
+				return fmt.Errorf("frame %d: bad packet block", n)
+			}
+			ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			iface := ifaces[id]
+			capturedPacket(n, iface.linkType, body[20:20+int(capLen)], pcapngTime(ts, iface.tsresol), iface.name, fn)
+			n++
+
+		case pcapngSimplePacket:
+			if len(body) < 4 || len(ifaces) == 0 {
+				return fmt.Errorf("frame %d: bad simple packet block", n)
+			}
+			capLen := len(body) - 4
+			if pl := order.Uint32(body); uint64(pl) < uint64(capLen) {
+				capLen = int(pl)
+			}
+			capturedPacket(n, ifaces[0].linkType, body[4:4+capLen], time.Time{}, ifaces[0].name, fn)
+			n++
+		}
+	}
+	return nil
+}
+
+// pcapngOptions calls fn for every option of b.
+func pcapngOptions(order binary.ByteOrder, b []byte, fn func(code uint16, v []byte)) {
+	for len(b) >= 4 {
+		code, l := order.Uint16(b), int(order.Uint16(b[2:]))
+		if code == pcapngOptEnd || 4+l > len(b) {
+			return
+		}
+		fn(code, b[4:4+l])
+		b = b[min(4+l+pad4(l), len(b)):]
+	}
+}
+
+// pcapngTime converts a timestamp in units of the if_tsresol option: a
+// negative power of 10, or of 2 if the high bit is set.
+func pcapngTime(ts uint64, tsresol byte) time.Time {
+	if tsresol&0x80 != 0 {
+		shift := tsresol & 0x7f
+		sec, frac := ts>>shift, ts&(1<<shift-1)
+		return time.Unix(int64(sec), int64(float64(frac)/float64(uint64(1)<<shift)*1e9))
+	}
+	unit := uint64(1)
+	for range min(tsresol, 19) { // 10^19 fits in an uint64
+		unit *= 10
+	}
+	sec, frac := ts/unit, ts%unit
+	if unit <= 1e9 {
+		return time.Unix(int64(sec), int64(frac*(1e9/unit)))
+	}
+	return time.Unix(int64(sec), int64(frac/(unit/1e9)))
+}
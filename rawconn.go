@@ -0,0 +1,229 @@
+package dhcp6c
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// RawConfig configures a raw connection created by NewRawConn.
+type RawConfig struct {
+	// VLAN is the 802.1Q VLAN ID. If 0 the frames are untagged, or
+	// priority tagged if Priority is not 0.
+	VLAN uint16
+	// Priority is the 802.1p priority code point (PCP), 0 to 7.
+	Priority uint8
+	// SrcIP is the source address, default is the link-local address of
+	// the interface.
+	SrcIP net.IP
+	// Port is the local UDP port, default is 546.
+	Port int
+	// HopLimit of the IPv6 header, default is 1 for multicast and 64 for
+	// unicast destinations.
+	HopLimit uint8
+	// TrafficClass of the IPv6 header, the DSCP is the 6 upper bits.
+	TrafficClass uint8
+}
+
+const (
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	protoUDP      = 17
+
+	// frameOverhead is the room for the headers in the frame read buffers:
+	// Ethernet with VLAN tags, IPv6 with extension headers and UDP.
+	frameOverhead = 128
+)
+
+var errNotForUs = errors.New("not a DHCPv6 packet for us")
+
+// buildFrame returns an Ethernet frame, 802.1Q tagged if needed, carrying
+// payload in an IPv6/UDP packet.
+func (cfg *RawConfig) buildFrame(srcMAC, dstMAC net.HardwareAddr, src, dst *net.UDPAddr, payload []byte) []byte {
+	b := make([]byte, 0, 18+ipv6HeaderLen+udpHeaderLen+len(payload))
+
+	// Ethernet
+	b = append(b, dstMAC...)
+	b = append(b, srcMAC...)
+	if cfg.VLAN != 0 || cfg.Priority != 0 {
+		b = binary.BigEndian.AppendUint16(b, etherTypeVLAN)
+		b = binary.BigEndian.AppendUint16(b, uint16(cfg.Priority&0x7)<<13|cfg.VLAN&0x0fff)
+	}
+	b = binary.BigEndian.AppendUint16(b, etherTypeIPv6)
+
+	// IPv6
+	hopLimit := cfg.HopLimit
+	if hopLimit == 0 {
+		hopLimit = 64
+		if dst.IP.IsMulticast() {
+			hopLimit = 1
+		}
+	}
+	udpLen := udpHeaderLen + len(payload)
+	b = append(b, 0x60|cfg.TrafficClass>>4, cfg.TrafficClass<<4, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+	b = append(b, protoUDP, hopLimit)
+	b = append(b, src.IP.To16()...)
+	b = append(b, dst.IP.To16()...)
+
+	// UDP
+	udp := len(b)
+	b = binary.BigEndian.AppendUint16(b, uint16(src.Port))
+	b = binary.BigEndian.AppendUint16(b, uint16(dst.Port))
+	b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+	b = append(b, 0, 0)
+	b = append(b, payload...)
+	binary.BigEndian.PutUint16(b[udp+6:], udpChecksum(src.IP, dst.IP, b[udp:]))
+	return b
+}
+
+// Frame returns the Ethernet frame a raw connection with this configuration
+// sends for p, from srcMAC to dstMAC (see DestinationMAC).
+func (cfg *RawConfig) Frame(srcMAC, dstMAC net.HardwareAddr, p *Packet) []byte {
+	return cfg.buildFrame(srcMAC, dstMAC, net.UDPAddrFromAddrPort(p.Source), net.UDPAddrFromAddrPort(p.Dest), p.Payload)
+}
+
+// DestinationMAC returns the Ethernet address a raw connection sends the
+// packets to ip to: the multicast address of the group, or the address in
+// the neighbor table. The packets aren't routed, ip must be on link.
+func DestinationMAC(ip net.IP) (net.HardwareAddr, error) {
+	if ip.IsMulticast() {
+		return multicastMAC(ip), nil
+	}
+	neigh, err := neighbors()
+	if err != nil {
+		return nil, err
+	}
+	mac := neigh[ip.String()]
+	if mac == nil {
+		return nil, fmt.Errorf("no neighbor entry for %s", ip)
+	}
+	return mac, nil
+}
+
+// udpChecksum computes the UDP checksum, including the IPv6 pseudo header.
+func udpChecksum(src, dst net.IP, udp []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	add(src.To16())
+	add(dst.To16())
+	sum += uint32(len(udp)) + protoUDP
+	add(udp)
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	if c := ^uint16(sum); c != 0 {
+		return c
+	}
+	return 0xffff
+}
+
+// parseFrame extracts the UDP payload of a frame sent to port and its source.
+// With errTruncated the payload is the available part.
+func parseFrame(frame []byte, port int) ([]byte, *net.UDPAddr, error) {
+	etherType, b := ethernetPayload(frame)
+	if etherType != etherTypeIPv6 {
+		return nil, nil, errNotForUs
+	}
+	payload, src, dst, err := parseIPv6UDP(b)
+	if err != nil && err != errTruncated || int(dst.Port()) != port {
+		return nil, nil, errNotForUs
+	}
+	return payload, net.UDPAddrFromAddrPort(src), err
+}
+
+// readBuffer returns the n bytes read buffer of a connection, buf is kept to
+// be reused by the next reads.
+func readBuffer(buf *[]byte, n int) []byte {
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	return (*buf)[:n]
+}
+
+// ethernetPayload returns the EtherType and payload of an Ethernet frame,
+// after the VLAN tags. The EtherType is 0 if the frame is too short.
+func ethernetPayload(frame []byte) (uint16, []byte) {
+	if len(frame) < 14 {
+		return 0, nil
+	}
+	etherType := binary.BigEndian.Uint16(frame[12:])
+	b := frame[14:]
+	for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(b) >= 4 {
+		etherType = binary.BigEndian.Uint16(b[2:])
+		b = b[4:]
+	}
+	return etherType, b
+}
+
+// errTruncated is returned by parseIPv6UDP for a datagram longer than the
+// packet: truncated by a capture, or the first fragment.
+var errTruncated = errors.New("truncated UDP datagram")
+
+// parseIPv6UDP extracts the UDP datagram of an IPv6 packet. With
+// errTruncated the payload is the available part.
+func parseIPv6UDP(b []byte) (payload []byte, src, dst netip.AddrPort, err error) {
+	if len(b) < ipv6HeaderLen || b[0]>>4 != 6 {
+		return nil, src, dst, errNotForUs
+	}
+	payloadLen := int(binary.BigEndian.Uint16(b[4:]))
+	next := b[6]
+	srcIP := netip.AddrFrom16([16]byte(b[8:24]))
+	dstIP := netip.AddrFrom16([16]byte(b[24:40]))
+	b = b[ipv6HeaderLen:]
+	if payloadLen < len(b) {
+		b = b[:payloadLen]
+	}
+	// skip the extension headers (hop-by-hop, routing, fragment,
+	// destination options)
+	for next == 0 || next == 43 || next == 44 || next == 60 {
+		if len(b) < 8 {
+			return nil, src, dst, errNotForUs
+		}
+		l := 8 * (int(b[1]) + 1)
+		if next == 44 {
+			if binary.BigEndian.Uint16(b[2:])>>3 != 0 {
+				// not the first fragment, no UDP header
+				return nil, src, dst, errNotForUs
+			}
+			l = 8
+		}
+		if l > len(b) {
+			return nil, src, dst, errNotForUs
+		}
+		next = b[0]
+		b = b[l:]
+	}
+	if next != protoUDP || len(b) < udpHeaderLen {
+		return nil, src, dst, errNotForUs
+	}
+	src = netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(b))
+	dst = netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(b[2:]))
+	udpLen := int(binary.BigEndian.Uint16(b[4:]))
+	if udpLen < udpHeaderLen {
+		return nil, src, dst, errNotForUs
+	}
+	if udpLen > len(b) {
+		return b[udpHeaderLen:], src, dst, errTruncated
+	}
+	return b[udpHeaderLen:udpLen], src, dst, nil
+}
+
+// multicastMAC returns the Ethernet address of an IPv6 multicast group.
+func multicastMAC(ip net.IP) net.HardwareAddr {
+	ip = ip.To16()
+	return net.HardwareAddr{0x33, 0x33, ip[12], ip[13], ip[14], ip[15]}
+}
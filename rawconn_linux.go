@@ -0,0 +1,178 @@
+package dhcp6c
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// RawConn is a net.PacketConn sending and receiving DHCPv6 messages on an
+// AF_PACKET socket. The Ethernet, 802.1Q, IPv6 and UDP headers are built by
+// RawConn, so the VLAN priority can be set, which a UDP socket can't do.
+type RawConn struct {
+	cfg   RawConfig
+	iface *net.Interface
+	local *net.UDPAddr
+	file  *os.File
+	rc    syscall.RawConn
+
+	// closed is set by Close, to report net.ErrClosed to readers.
+	closed atomic.Bool
+
+	// rmu serializes the readers of the frame buffer.
+	rmu   sync.Mutex
+	frame []byte
+}
+
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return binary.NativeEndian.Uint16(b[:])
+}
+
+// NewRawConn returns a raw connection on the given interface. It requires
+// the CAP_NET_RAW capability.
+func NewRawConn(iface string, cfg RawConfig) (net.PacketConn, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(i.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("%s is not an Ethernet interface", iface)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = dhcpv6.DefaultClientPort
+	}
+	if cfg.SrcIP == nil {
+		if cfg.SrcIP, err = dhcpv6.GetLinkLocalAddr(iface); err != nil {
+			return nil, err
+		}
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, int(htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ALL), Ifindex: i.Index}); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	file := os.NewFile(uintptr(fd), "packet:"+iface)
+	rc, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &RawConn{
+		cfg:   cfg,
+		iface: i,
+		local: &net.UDPAddr{IP: cfg.SrcIP, Port: cfg.Port, Zone: iface},
+		file:  file,
+		rc:    rc,
+	}, nil
+}
+
+// ReadFrom implements net.PacketConn. Frames which are not UDP to the local
+// port are skipped. As with a UDP socket, a datagram larger than b is
+// truncated to len(b) bytes.
+func (c *RawConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	frame := readBuffer(&c.frame, len(b)+frameOverhead)
+	for {
+		var n int
+		var sa syscall.Sockaddr
+		var rerr error
+		err := c.rc.Read(func(fd uintptr) bool {
+			n, sa, rerr = syscall.Recvfrom(int(fd), frame, 0)
+			return rerr != syscall.EAGAIN
+		})
+		if err == nil {
+			err = rerr
+		}
+		if err != nil {
+			if c.closed.Load() {
+				err = net.ErrClosed
+			}
+			return 0, nil, err
+		}
+		if ll, ok := sa.(*syscall.SockaddrLinklayer); ok && ll.Pkttype == syscall.PACKET_OUTGOING {
+			continue
+		}
+		payload, from, err := parseFrame(frame[:n], c.cfg.Port)
+		if err == errTruncated && len(payload) < len(b) {
+			// a fragment, or a frame truncated by the extension
+			// headers: the size of the datagram is unknown
+			continue
+		}
+		if err != nil && err != errTruncated {
+			continue
+		}
+		if from.IP.IsLinkLocalUnicast() {
+			from.Zone = c.iface.Name
+		}
+		return copy(b, payload), from, nil
+	}
+}
+
+// WriteTo implements net.PacketConn. addr must be a *net.UDPAddr, unicast
+// destinations are resolved with the neighbor table.
+func (c *RawConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	dst, ok := addr.(*net.UDPAddr)
+	if !ok || dst.IP.To4() != nil {
+		return 0, fmt.Errorf("bad destination %v", addr)
+	}
+	dstMAC, err := DestinationMAC(dst.IP)
+	if err != nil {
+		return 0, err
+	}
+	frame := c.cfg.buildFrame(c.iface.HardwareAddr, dstMAC, c.local, dst, b)
+	sa := &syscall.SockaddrLinklayer{Ifindex: c.iface.Index, Halen: 6}
+	copy(sa.Addr[:], dstMAC)
+
+	var werr error
+	err = c.rc.Write(func(fd uintptr) bool {
+		werr = syscall.Sendto(int(fd), frame, 0, sa)
+		return werr != syscall.EAGAIN
+	})
+	if err == nil {
+		err = werr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close implements net.PacketConn.
+func (c *RawConn) Close() error {
+	c.closed.Store(true)
+	return c.file.Close()
+}
+
+// LocalAddr implements net.PacketConn.
+func (c *RawConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// SetDeadline implements net.PacketConn.
+func (c *RawConn) SetDeadline(t time.Time) error {
+	return c.file.SetDeadline(t)
+}
+
+// SetReadDeadline implements net.PacketConn.
+func (c *RawConn) SetReadDeadline(t time.Time) error {
+	return c.file.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.PacketConn.
+func (c *RawConn) SetWriteDeadline(t time.Time) error {
+	return c.file.SetWriteDeadline(t)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package dhcp6c
+
+import (
+	"errors"
+	"net"
+)
+
+// NewRawConn returns a raw connection on the given interface.
+// Only implemented on Linux (AF_PACKET).
+func NewRawConn(iface string, cfg RawConfig) (net.PacketConn, error) {
+	return nil, errors.New("raw connections are only supported on Linux")
+}
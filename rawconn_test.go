@@ -0,0 +1,101 @@
+package dhcp6c
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+// The checksums were computed separately, from the RFC 8200 pseudo header.
+func TestUDPChecksum(t *testing.T) {
+	for _, tt := range []struct {
+		src, dst string
+		payload  string
+		want     uint16
+	}{
+		{"fe80::1", "ff02::1:2", "01abcdef000800020000", 0x2e59},
+		{"2001:db8::1", "2001:db8::547", "01abcdef00", 0xcb3a}, // odd length
+	} {
+		t.Run(tt.dst, func(t *testing.T) {
+			payload, _ := hex.DecodeString(tt.payload)
+			udp := binary.BigEndian.AppendUint16(nil, 546)
+			udp = binary.BigEndian.AppendUint16(udp, 547)
+			udp = binary.BigEndian.AppendUint16(udp, uint16(udpHeaderLen+len(payload)))
+			udp = append(udp, 0, 0)
+			udp = append(udp, payload...)
+			if got := udpChecksum(net.ParseIP(tt.src), net.ParseIP(tt.dst), udp); got != tt.want {
+				t.Errorf("checksum %#04x, want %#04x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFrame(t *testing.T) {
+	srcMAC := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	dstMAC := multicastMAC(AllDHCPRelayAgentsAndServers.IP)
+	src := &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 546}
+	payload, _ := hex.DecodeString("01abcdef000800020000")
+
+	for _, tt := range []struct {
+		name     string
+		cfg      RawConfig
+		tag      string // 802.1Q tag control information
+		hopLimit byte
+		tc       byte
+	}{
+		{"untagged", RawConfig{}, "", 1, 0},
+		{"vlan", RawConfig{VLAN: 832}, "0340", 1, 0},
+		{"vlan and priority", RawConfig{VLAN: 832, Priority: 6}, "c340", 1, 0},
+		{"priority tagged", RawConfig{Priority: 5}, "a000", 1, 0},
+		{"hop limit and traffic class", RawConfig{HopLimit: 64, TrafficClass: 0xb8}, "", 64, 0xb8},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := tt.cfg.buildFrame(srcMAC, dstMAC, src, AllDHCPRelayAgentsAndServers, payload)
+
+			if !bytes.Equal(frame[:6], dstMAC) || !bytes.Equal(frame[6:12], srcMAC) {
+				t.Errorf("MACs %x %x, want %x %x", frame[:6], frame[6:12], dstMAC, srcMAC)
+			}
+			b := frame[12:]
+			if tt.tag != "" {
+				if got := hex.EncodeToString(b[:4]); got != "8100"+tt.tag {
+					t.Errorf("802.1Q tag %s, want 8100%s", got, tt.tag)
+				}
+				b = b[4:]
+			}
+			if got := binary.BigEndian.Uint16(b); got != etherTypeIPv6 {
+				t.Fatalf("EtherType %#04x, want %#04x", got, etherTypeIPv6)
+			}
+			ip := b[2:]
+			if tc := ip[0]<<4 | ip[1]>>4; tc != tt.tc {
+				t.Errorf("traffic class %#02x, want %#02x", tc, tt.tc)
+			}
+			if ip[7] != tt.hopLimit {
+				t.Errorf("hop limit %d, want %d", ip[7], tt.hopLimit)
+			}
+			if got := binary.BigEndian.Uint16(ip[ipv6HeaderLen+6:]); got != 0x2e59 {
+				t.Errorf("UDP checksum %#04x, want 0x2e59", got)
+			}
+
+			got, from, err := parseFrame(frame, 547)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("payload %x, want %x", got, payload)
+			}
+			if !from.IP.Equal(src.IP) || from.Port != src.Port {
+				t.Errorf("source %s, want %s", from, src)
+			}
+
+			if _, _, err := parseFrame(frame, 546); err != errNotForUs {
+				t.Errorf("other port: error %v, want %v", err, errNotForUs)
+			}
+			got, _, err = parseFrame(frame[:len(frame)-3], 547)
+			if err != errTruncated || !bytes.Equal(got, payload[:len(payload)-3]) {
+				t.Errorf("truncated: payload %x error %v, want %x %v", got, err, payload[:len(payload)-3], errTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package dhcp6c
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// RelayConfig configures the relay agent emulation: each message sent by the
+// Client is encapsulated in a Relay-Forward message (RFC 8415 section 19.1)
+// and Relay-Reply messages received are decapsulated.
+type RelayConfig struct {
+	// LinkAddr is the link-address field. If nil, :: is sent and
+	// InterfaceID should be set so the server can identify the link.
+	LinkAddr net.IP
+	// PeerAddr is the peer-address field, the address of the client.
+	PeerAddr net.IP
+	// InterfaceID is the Interface-ID option, omitted if nil.
+	InterfaceID []byte
+	// RemoteID is the Remote-ID option (RFC 4649), omitted if nil.
+	RemoteID *dhcpv6.OptRemoteID
+	// SubscriberID is the Subscriber-ID option (RFC 4580), omitted if nil.
+	SubscriberID []byte
+}
+
+// WithRelay enables the relay agent emulation.
+//
+// Servers send Relay-Reply messages to port 547, so the connection should be
+// created with NewRelayConn and the server address set with WithBroadcastAddr.
+func WithRelay(cfg RelayConfig) ClientOpt {
+	return func(c *Client) {
+		c.relay = &cfg
+	}
+}
+
+// NewRelayConn returns a UDP connection bound to port on all addresses, as
+// used by a relay agent to receive the Relay-Reply messages from servers.
+func NewRelayConn(port int) (net.PacketConn, error) {
+	return net.ListenUDP("udp6", &net.UDPAddr{
+		IP:   net.IPv6unspecified,
+		Port: port,
+	})
+}
+
+// encapsulate returns the bytes to send for msg, wrapped in a Relay-Forward
+// message when relay agent emulation is enabled.
+func (c *Client) encapsulate(msg *dhcpv6.Message) ([]byte, error) {
+	if c.relay == nil {
+		return msg.ToBytes(), nil
+	}
+	relay, err := dhcpv6.EncapsulateRelay(msg, dhcpv6.MessageTypeRelayForward, c.relay.LinkAddr, c.relay.PeerAddr)
+	if err != nil {
+		return nil, err
+	}
+	if c.relay.InterfaceID != nil {
+		relay.AddOption(dhcpv6.OptInterfaceID(c.relay.InterfaceID))
+	}
+	if c.relay.RemoteID != nil {
+		relay.AddOption(c.relay.RemoteID)
+	}
+	if c.relay.SubscriberID != nil {
+		relay.AddOption(&dhcpv6.OptionGeneric{
+			OptionCode: dhcpv6.OptionRelayAgentSubscriberID,
+			OptionData: c.relay.SubscriberID,
+		})
+	}
+	c.logger.Printf("relay-forward: hopcount=%d linkaddr=%s peeraddr=%s options=%s",
+		relay.HopCount, relay.LinkAddr, relay.PeerAddr, relay.Options.Options)
+	return relay.ToBytes(), nil
+}
+
+// decapsulate parses a received packet. When relay agent emulation is
+// enabled, Relay-Reply messages are unwrapped down to the client message.
+func (c *Client) decapsulate(b []byte) (*dhcpv6.Message, error) {
+	if c.relay == nil {
+		return dhcpv6.MessageFromBytes(b)
+	}
+	d, err := dhcpv6.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	if d.IsRelay() && d.Type() != dhcpv6.MessageTypeRelayReply {
+		return nil, fmt.Errorf("unexpected %s message", d.Type())
+	}
+	return d.GetInnerMessage()
+}
@@ -0,0 +1,57 @@
+package dhcp6c
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// enableRxMeta asks for the receiving interface and the kernel timestamp of
+// the datagrams, in the control messages.
+func enableRxMeta(conn *net.UDPConn) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		if serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); serr != nil {
+			return
+		}
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return os.NewSyscallError("setsockopt", serr)
+}
+
+// parseRxMeta returns the interface index and the timestamp of the control
+// messages, 0 and the zero time if absent.
+func parseRxMeta(oob []byte) (int, time.Time) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, time.Time{}
+	}
+	var ifindex int
+	var ts time.Time
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS:
+			if len(m.Data) >= int(unsafe.Sizeof(unix.Timespec{})) {
+				t := (*unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+				ts = time.Unix(t.Unix())
+			}
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_PKTINFO:
+			// struct in6_pktinfo: address then interface index
+			if len(m.Data) >= unix.SizeofInet6Pktinfo {
+				ifindex = int(binary.NativeEndian.Uint32(m.Data[16:]))
+			}
+		}
+	}
+	return ifindex, ts
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package dhcp6c
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// enableRxMeta is not implemented on this platform, ReadFrom is used.
+func enableRxMeta(conn *net.UDPConn) error {
+	return errors.New("not implemented on this platform")
+}
+
+func parseRxMeta(oob []byte) (int, time.Time) {
+	return 0, time.Time{}
+}
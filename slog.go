@@ -0,0 +1,106 @@
+package dhcp6c
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// WithSlog emits a structured record for every client event to l:
+//
+//   - "dhcpv6 send" and "dhcpv6 retransmit" (debug), once the message is
+//     written: xid, type, dest, attempt
+//   - "dhcpv6 receive" (debug): xid, type, source, interface, rtt,
+//     server_duid, prefixes
+//   - "dhcpv6 drop" (warn): reason, and xid, type, source when known
+//   - "dhcpv6 timeout" (info): xid, type, dest, attempts, elapsed
+//   - "dhcpv6 receive error" (error): error, when the receive loop stops
+//
+// It is independent of WithLogger, both can be used.
+func WithSlog(l *slog.Logger) ClientOpt {
+	return func(c *Client) {
+		c.slog = l
+	}
+}
+
+// msgAttrs returns the attributes identifying msg.
+func msgAttrs(msg *dhcpv6.Message) []slog.Attr {
+	return []slog.Attr{
+		slog.String("xid", msg.TransactionID.String()),
+		slog.String("type", msg.MessageType.String()),
+	}
+}
+
+func (c *Client) slogSend(msg *dhcpv6.Message, dest net.Addr, attempt int) {
+	if c.slog == nil {
+		return
+	}
+	event := "dhcpv6 send"
+	if attempt > 1 {
+		event = "dhcpv6 retransmit"
+	}
+	attrs := append(msgAttrs(msg), slog.String("dest", dest.String()), slog.Int("attempt", attempt))
+	c.slog.LogAttrs(context.Background(), slog.LevelDebug, event, attrs...)
+}
+
+func (c *Client) slogReceive(e *Envelope) {
+	if c.slog == nil {
+		return
+	}
+	attrs := append(msgAttrs(e.Message),
+		slog.String("source", e.Source.String()),
+		slog.String("interface", e.Interface),
+		slog.Duration("rtt", e.RTT()))
+	if duid := e.Message.Options.ServerID(); duid != nil {
+		attrs = append(attrs, slog.String("server_duid", FormatDUID(duid)))
+	}
+	var prefixes []string
+	for _, iapd := range e.Message.Options.IAPD() {
+		for _, p := range iapd.Options.Prefixes() {
+			if p.Prefix != nil {
+				prefixes = append(prefixes, p.Prefix.String())
+			}
+		}
+	}
+	if prefixes != nil {
+		attrs = append(attrs, slog.Any("prefixes", prefixes))
+	}
+	c.slog.LogAttrs(context.Background(), slog.LevelDebug, "dhcpv6 receive", attrs...)
+}
+
+// slogDrop logs a dropped datagram, msg is nil if it couldn't be decoded.
+func (c *Client) slogDrop(reason string, msg *dhcpv6.Message, peer net.Addr) {
+	if c.slog == nil {
+		return
+	}
+	attrs := []slog.Attr{slog.String("reason", reason)}
+	if msg != nil {
+		attrs = append(attrs, msgAttrs(msg)...)
+	}
+	if peer != nil {
+		attrs = append(attrs, slog.String("source", peer.String()))
+	}
+	c.slog.LogAttrs(context.Background(), slog.LevelWarn, "dhcpv6 drop", attrs...)
+}
+
+func (c *Client) slogTimeout(msg *dhcpv6.Message, dest net.Addr, attempts int, elapsed time.Duration) {
+	if c.slog == nil {
+		return
+	}
+	attrs := append(msgAttrs(msg),
+		slog.String("dest", dest.String()),
+		slog.Int("attempts", attempts),
+		slog.Duration("elapsed", elapsed))
+	c.slog.LogAttrs(context.Background(), slog.LevelInfo, "dhcpv6 timeout", attrs...)
+}
+
+// slogError logs the error which stopped the receive loop.
+func (c *Client) slogError(err error) {
+	if c.slog == nil {
+		return
+	}
+	c.slog.LogAttrs(context.Background(), slog.LevelError, "dhcpv6 receive error", slog.String("error", err.Error()))
+}
@@ -0,0 +1,121 @@
+package dhcp6c
+
+import (
+	"sync"
+)
+
+// subscriber receives the unsolicited messages matching match.
+type subscriber struct {
+	match Matcher
+	fn    func(e *Envelope)
+	// stop is called when the client stops receiving, if not nil.
+	stop func()
+}
+
+// Subscribe calls fn for every received message which matches no pending
+// transaction (a Reconfigure, or a stray Advertise or Reply) and matches
+// match, all of them if match is nil. fn is called by the receive loop: it
+// must not block, or it delays the other messages.
+//
+// The returned function cancels the subscription.
+func (c *Client) Subscribe(match Matcher, fn func(e *Envelope)) (cancel func()) {
+	return c.subscribe(&subscriber{match: match, fn: fn})
+}
+
+// SubscribeChan is Subscribe sending the messages to a channel of the given
+// size. Messages are dropped when the channel is full.
+//
+// The channel is closed by cancel or when the client stops receiving (see
+// Done), it is returned closed if the client has already stopped.
+func (c *Client) SubscribeChan(match Matcher, size int) (<-chan *Envelope, func()) {
+	ch := make(chan *Envelope, size)
+	var mu sync.Mutex
+	closed := false
+	stop := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+	s := &subscriber{
+		match: match,
+		fn: func(e *Envelope) {
+			mu.Lock()
+			defer mu.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case ch <- e:
+			default:
+				if c.printDropped {
+					c.logger.Printf("Subscriber channel full, %s dropped", e.Message.MessageType)
+				}
+			}
+		},
+		stop: stop,
+	}
+	unsubscribe := c.subscribe(s)
+	return ch, func() {
+		unsubscribe()
+		stop()
+	}
+}
+
+// subscribe adds s, or stops it if the client has stopped receiving.
+func (c *Client) subscribe(s *subscriber) func() {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	select {
+	case <-c.done:
+		// stopSubscribers has run or waits for subMu
+		if s.stop != nil {
+			s.stop()
+		}
+		return func() {}
+	default:
+	}
+	if c.subs == nil {
+		c.subs = make(map[*subscriber]struct{})
+	}
+	c.subs[s] = struct{}{}
+	return func() {
+		c.subMu.Lock()
+		defer c.subMu.Unlock()
+		delete(c.subs, s)
+	}
+}
+
+// dispatch passes an unsolicited message to the matching subscribers and
+// returns whether there was one.
+func (c *Client) dispatch(e *Envelope) bool {
+	c.subMu.Lock()
+	var subs []*subscriber
+	for s := range c.subs {
+		if s.match == nil || s.match(e.Message) {
+			subs = append(subs, s)
+		}
+	}
+	c.subMu.Unlock()
+
+	for _, s := range subs {
+		s.fn(e)
+	}
+	return len(subs) > 0
+}
+
+// stopSubscribers removes the subscribers, closing their channels.
+func (c *Client) stopSubscribers() {
+	c.subMu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.subMu.Unlock()
+
+	for s := range subs {
+		if s.stop != nil {
+			s.stop()
+		}
+	}
+}
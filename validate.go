@@ -0,0 +1,58 @@
+package dhcp6c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/insomniacslk/dhcp/dhcpv6"
+)
+
+// WithoutValidation accepts the responses failing the checks of validate,
+// to test non compliant servers.
+func WithoutValidation() ClientOpt {
+	return func(c *Client) {
+		c.noValidation = true
+	}
+}
+
+// validate checks msg is a valid response to sent, see RFC 8415 section 16:
+// the message type must be expected for the exchange, the Server Identifier
+// option present and the Client Identifier option echoed.
+func validate(sent, msg *dhcpv6.Message) error {
+	if !expectedResponse(sent, msg) {
+		return fmt.Errorf("unexpected %s in response to %s", msg.MessageType, sent.MessageType)
+	}
+	if msg.GetOneOption(dhcpv6.OptionServerID) == nil {
+		return errors.New("no Server Identifier option")
+	}
+	cid := sent.GetOneOption(dhcpv6.OptionClientID)
+	if cid == nil {
+		// Information-request may be sent without
+		return nil
+	}
+	got := msg.GetOneOption(dhcpv6.OptionClientID)
+	if got == nil {
+		return errors.New("no Client Identifier option")
+	}
+	if !bytes.Equal(got.ToBytes(), cid.ToBytes()) {
+		// the DUID is left out, the errors are logged and reported as text
+		return errors.New("Client Identifier option doesn't match ours")
+	}
+	return nil
+}
+
+// expectedResponse returns whether the type of msg is a response to the
+// type of sent. A Reply to a Solicit is only expected with Rapid Commit.
+func expectedResponse(sent, msg *dhcpv6.Message) bool {
+	switch sent.MessageType {
+	case dhcpv6.MessageTypeSolicit:
+		return msg.MessageType == dhcpv6.MessageTypeAdvertise ||
+			msg.MessageType == dhcpv6.MessageTypeReply && sent.GetOneOption(dhcpv6.OptionRapidCommit) != nil
+	case dhcpv6.MessageTypeRequest, dhcpv6.MessageTypeConfirm, dhcpv6.MessageTypeRenew,
+		dhcpv6.MessageTypeRebind, dhcpv6.MessageTypeRelease, dhcpv6.MessageTypeDecline,
+		dhcpv6.MessageTypeInformationRequest:
+		return msg.MessageType == dhcpv6.MessageTypeReply
+	}
+	return false
+}